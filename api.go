@@ -16,10 +16,19 @@ type CachetAPI struct {
 	URL      string `json:"url"`
 	Token    string `json:"token"`
 	Insecure bool   `json:"insecure"`
+
+	// Proxy used to reach Cachet (environment when not set)
+	Proxy *ProxyConfig `json:"proxy"`
 }
 
 type CachetResponse struct {
 	Data json.RawMessage `json:"data"`
+	Meta struct {
+		Pagination struct {
+			CurrentPage int `json:"current_page"`
+			TotalPages  int `json:"total_pages"`
+		} `json:"pagination"`
+	} `json:"meta"`
 }
 
 // TODO: test
@@ -38,11 +47,11 @@ func (api CachetAPI) Ping() error {
 
 // SendMetric adds a data point to a cachet monitor - Deprecated
 func (api CachetAPI) SendMetric(l *logrus.Entry, id int, lag int64) {
-	api.SendMetrics(l, "lag", []int { id }, lag)
+	api.SendMetrics(l, "lag", []int { id }, float64(lag))
 }
 
 // SendMetrics adds a data point to a cachet monitor
-func (api CachetAPI) SendMetrics(l *logrus.Entry, metricname string, arr []int, val int64) {
+func (api CachetAPI) SendMetrics(l *logrus.Entry, metricname string, arr []int, val float64) {
 	for _, v := range arr {
 		l.Infof("Sending %s metric ID:%d => %v", metricname, v, val)
 
@@ -105,6 +114,34 @@ func (api CachetAPI) SetComponentStatus(comp *AbstractMonitor, status int) (Comp
 	return compInfo
 }
 
+// GetSchedules returns the scheduled maintenances (all pages)
+func (api CachetAPI) GetSchedules() ([]Schedule, error) {
+	schedules := []Schedule{}
+	for page := 1; ; page++ {
+		resp, body, err := api.NewRequest("GET", "/schedules?per_page=100&page="+strconv.Itoa(page), nil)
+		if err != nil {
+			logrus.Warnf("Could not get schedules: %v", err)
+			return nil, err
+		}
+
+		if resp.StatusCode != 200 {
+			logrus.Warnf("Could not get schedules (status: %d)", resp.StatusCode)
+			return nil, errors.New("API Responded with non-200 status code")
+		}
+
+		pageSchedules := []Schedule{}
+		if err := json.Unmarshal(body.Data, &pageSchedules); err != nil {
+			logrus.Warnf("Error decoding schedules: %v", err)
+			return nil, err
+		}
+		schedules = append(schedules, pageSchedules...)
+
+		if len(pageSchedules) == 0 || page >= body.Meta.Pagination.TotalPages {
+			return schedules, nil
+		}
+	}
+}
+
 // TODO: test
 // NewRequest wraps http.NewRequest
 func (api CachetAPI) NewRequest(requestType, url string, reqBody []byte) (*http.Response, CachetResponse, error) {
@@ -113,8 +150,14 @@ func (api CachetAPI) NewRequest(requestType, url string, reqBody []byte) (*http.
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("X-Cachet-Token", api.Token)
 
-	transport := http.DefaultTransport.(*http.Transport)
+	// own transport: the default one is shared with the rest of the process
+	transport := http.DefaultTransport.(*http.Transport).Clone()
 	transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: api.Insecure}
+	if api.Proxy != nil {
+		// the default transport uses the environment
+		transport.Proxy = api.Proxy.proxyFunc()
+	}
+	transport.DisableKeepAlives = true
 	client := &http.Client{
 		Transport: transport,
 	}
@@ -123,10 +166,9 @@ func (api CachetAPI) NewRequest(requestType, url string, reqBody []byte) (*http.
 	if err != nil {
 		return nil, CachetResponse{}, err
 	}
+	defer res.Body.Close()
 
-	var body struct {
-		Data json.RawMessage `json:"data"`
-	}
+	var body CachetResponse
 	err = json.NewDecoder(res.Body).Decode(&body)
 
 	return res, body, err
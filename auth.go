@@ -0,0 +1,242 @@
+package cachet
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultTokenRefreshMargin is how long (seconds) before its expiry an OAuth2 token is renewed
+const DefaultTokenRefreshMargin = 60
+
+// HTTPAuth authenticates the requests of an HTTP monitor.
+// Secrets can be read from the environment (*_env) or a file (*_file) instead of the config.
+type HTTPAuth struct {
+	// basic / bearer / oauth2 (client credentials)
+	Type string
+
+	// basic
+	Username     string
+	UsernameEnv  string `mapstructure:"username_env"`
+	UsernameFile string `mapstructure:"username_file"`
+	Password     string
+	PasswordEnv  string `mapstructure:"password_env"`
+	PasswordFile string `mapstructure:"password_file"`
+
+	// bearer
+	Token     string
+	TokenEnv  string `mapstructure:"token_env"`
+	TokenFile string `mapstructure:"token_file"`
+
+	// oauth2
+	TokenURL         string `mapstructure:"token_url"`
+	ClientID         string `mapstructure:"client_id"`
+	ClientSecret     string `mapstructure:"client_secret"`
+	ClientSecretEnv  string `mapstructure:"client_secret_env"`
+	ClientSecretFile string `mapstructure:"client_secret_file"`
+	Scopes           []string
+
+	// cached OAuth2 token
+	mu          sync.Mutex
+	accessToken string
+	expiry      time.Time
+}
+
+// readSecret reads the secret from the environment variable or the file when set, value otherwise
+func readSecret(name string, value string, env string, file string) (string, error) {
+	if len(env) > 0 {
+		secret, ok := os.LookupEnv(env)
+		if !ok {
+			return "", errors.New("environment variable " + env + " (" + name + ") is not set")
+		}
+		return secret, nil
+	}
+
+	if len(file) > 0 {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return "", errors.New("could not read " + name + ": " + err.Error())
+		}
+		return strings.TrimSpace(string(data)), nil
+	}
+
+	return value, nil
+}
+
+// apply sets the Authorization header, fetching an OAuth2 token with client when needed.
+// Errors are about getting the credentials, not about the monitored service.
+func (auth *HTTPAuth) apply(req *http.Request, client *http.Client) error {
+	switch auth.Type {
+	case "basic":
+		username, err := readSecret("username", auth.Username, auth.UsernameEnv, auth.UsernameFile)
+		if err != nil {
+			return errors.New("Authentication failed: " + err.Error())
+		}
+		password, err := readSecret("password", auth.Password, auth.PasswordEnv, auth.PasswordFile)
+		if err != nil {
+			return errors.New("Authentication failed: " + err.Error())
+		}
+		req.SetBasicAuth(username, password)
+	case "bearer":
+		token, err := readSecret("token", auth.Token, auth.TokenEnv, auth.TokenFile)
+		if err != nil {
+			return errors.New("Authentication failed: " + err.Error())
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	case "oauth2":
+		token, err := auth.oauth2Token(client)
+		if err != nil {
+			return errors.New("OAuth2 token request failed: " + err.Error())
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	return nil
+}
+
+// rejected drops the cached token after a 401 so that the next check gets a new one
+func (auth *HTTPAuth) rejected() {
+	auth.mu.Lock()
+	defer auth.mu.Unlock()
+
+	auth.accessToken = ""
+}
+
+// oauth2Token returns the cached token or requests a new one (client credentials grant)
+func (auth *HTTPAuth) oauth2Token(client *http.Client) (string, error) {
+	auth.mu.Lock()
+	defer auth.mu.Unlock()
+
+	if len(auth.accessToken) > 0 && (auth.expiry.IsZero() || time.Now().Before(auth.expiry)) {
+		return auth.accessToken, nil
+	}
+
+	secret, err := readSecret("client secret", auth.ClientSecret, auth.ClientSecretEnv, auth.ClientSecretFile)
+	if err != nil {
+		return "", err
+	}
+
+	form := url.Values{"grant_type": {"client_credentials"}}
+	if len(auth.Scopes) > 0 {
+		form.Set("scope", strings.Join(auth.Scopes, " "))
+	}
+	req, err := http.NewRequest("POST", auth.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("User-Agent", "Cachet-Monitor")
+	req.SetBasicAuth(url.QueryEscape(auth.ClientID), url.QueryEscape(secret))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		AccessToken      string      `json:"access_token"`
+		TokenType        string      `json:"token_type"`
+		ExpiresIn        json.Number `json:"expires_in"`
+		Error            string      `json:"error"`
+		ErrorDescription string      `json:"error_description"`
+	}
+	decodeErr := json.NewDecoder(resp.Body).Decode(&body)
+
+	if resp.StatusCode != 200 {
+		reason := "token endpoint returned HTTP status " + strconv.Itoa(resp.StatusCode)
+		if len(body.Error) > 0 {
+			reason += " (" + strings.TrimSpace(body.Error+" "+body.ErrorDescription) + ")"
+		}
+		return "", errors.New(reason)
+	}
+	if decodeErr != nil {
+		return "", errors.New("invalid token response: " + decodeErr.Error())
+	}
+	if len(body.AccessToken) == 0 {
+		return "", errors.New("no access_token in the token response")
+	}
+	if len(body.TokenType) > 0 && strings.ToLower(body.TokenType) != "bearer" {
+		return "", errors.New("unsupported token type: " + body.TokenType)
+	}
+
+	auth.accessToken = body.AccessToken
+	auth.expiry = time.Time{}
+	if expiresIn, err := body.ExpiresIn.Int64(); err == nil && expiresIn > 0 {
+		lifetime := time.Duration(expiresIn) * time.Second
+		margin := DefaultTokenRefreshMargin * time.Second
+		if margin > lifetime/2 {
+			margin = lifetime / 2
+		}
+		auth.expiry = time.Now().Add(lifetime - margin)
+	}
+
+	return auth.accessToken, nil
+}
+
+// Validate checks the fields required by the auth type
+func (auth *HTTPAuth) Validate() []string {
+	errs := []string{}
+
+	exclusive := func(name string, sources ...string) {
+		set := 0
+		for _, s := range sources {
+			if len(s) > 0 {
+				set++
+			}
+		}
+		if set > 1 {
+			errs = append(errs, "'auth': only one of '"+name+"', '"+name+"_env' and '"+name+"_file' can be set")
+		}
+	}
+
+	auth.Type = strings.ToLower(auth.Type)
+	switch auth.Type {
+	case "basic":
+		if len(auth.Username) == 0 && len(auth.UsernameEnv) == 0 && len(auth.UsernameFile) == 0 {
+			errs = append(errs, "'auth': 'username' has not been set")
+		}
+		exclusive("username", auth.Username, auth.UsernameEnv, auth.UsernameFile)
+		exclusive("password", auth.Password, auth.PasswordEnv, auth.PasswordFile)
+	case "bearer":
+		if len(auth.Token) == 0 && len(auth.TokenEnv) == 0 && len(auth.TokenFile) == 0 {
+			errs = append(errs, "'auth': 'token' has not been set")
+		}
+		exclusive("token", auth.Token, auth.TokenEnv, auth.TokenFile)
+	case "oauth2":
+		if u, err := url.Parse(auth.TokenURL); err != nil || !u.IsAbs() {
+			errs = append(errs, "'auth': 'token_url' has to be an absolute URL")
+		}
+		if len(auth.ClientID) == 0 {
+			errs = append(errs, "'auth': 'client_id' has not been set")
+		}
+		exclusive("client_secret", auth.ClientSecret, auth.ClientSecretEnv, auth.ClientSecretFile)
+	default:
+		errs = append(errs, "'auth': unsupported type '"+auth.Type+"' (expected basic, bearer or oauth2)")
+	}
+
+	return errs
+}
+
+func (auth *HTTPAuth) String() string {
+	switch auth.Type {
+	case "basic":
+		if len(auth.Username) == 0 {
+			// not revealed when kept out of the config
+			return "basic"
+		}
+		return "basic (" + auth.Username + ")"
+	case "oauth2":
+		return "oauth2 (" + auth.TokenURL + ")"
+	}
+
+	return auth.Type
+}
@@ -0,0 +1,119 @@
+package cachet
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Sirupsen/logrus"
+)
+
+func TestHTTPMonitorAuth(t *testing.T) {
+	tokens := 0
+	mux := http.NewServeMux()
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		id, secret, _ := r.BasicAuth()
+		if id != "monitor" || secret != "s3cr3t" || r.FormValue("grant_type") != "client_credentials" || r.FormValue("scope") != "status:read" {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"error":"invalid_client","error_description":"bad credentials"}`))
+			return
+		}
+		tokens++
+		w.Write([]byte(`{"access_token":"t0k3n","token_type":"Bearer","expires_in":3600}`))
+	})
+	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
+		user, password, ok := r.BasicAuth()
+		if r.Header.Get("Authorization") == "Bearer t0k3n" || (ok && user == "admin" && password == "pa55") {
+			w.Write([]byte("OK"))
+			return
+		}
+		w.WriteHeader(http.StatusUnauthorized)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	l := logrus.WithFields(logrus.Fields{})
+	mon := &HTTPMonitor{ExpectedStatusCode: 200}
+	mon.Name, mon.Target, mon.ComponentID, mon.Timeout = "http", server.URL+"/health", 1, 1
+
+	// basic, password from a file
+	file := filepath.Join(t.TempDir(), "password")
+	ioutil.WriteFile(file, []byte("pa55\n"), 0600)
+	mon.Auth = &HTTPAuth{Type: "basic", Username: "admin", PasswordFile: file}
+	if errs := mon.Validate(); len(errs) > 0 {
+		t.Fatalf("unexpected validation errors: %v", errs)
+	}
+	if !mon.test(l) {
+		t.Errorf("check should have passed: %s", mon.lastFailReason)
+	}
+
+	// basic, username from the environment and from a file
+	os.Setenv("CACHET_TEST_USERNAME", "admin")
+	defer os.Unsetenv("CACHET_TEST_USERNAME")
+	mon.Auth = &HTTPAuth{Type: "basic", UsernameEnv: "CACHET_TEST_USERNAME", PasswordFile: file}
+	if errs := mon.Validate(); len(errs) > 0 {
+		t.Fatalf("unexpected validation errors: %v", errs)
+	}
+	if !mon.test(l) {
+		t.Errorf("check should have passed: %s", mon.lastFailReason)
+	}
+
+	usernameFile := filepath.Join(t.TempDir(), "username")
+	ioutil.WriteFile(usernameFile, []byte("admin\n"), 0600)
+	mon.Auth = &HTTPAuth{Type: "basic", UsernameFile: usernameFile, Password: "pa55"}
+	mon.Validate()
+	if !mon.test(l) {
+		t.Errorf("check should have passed: %s", mon.lastFailReason)
+	}
+	if mon.Auth.String() != "basic" {
+		t.Errorf("username kept out of the config should not be described, got %q", mon.Auth.String())
+	}
+
+	mon.Auth = &HTTPAuth{Type: "basic", UsernameEnv: "CACHET_TEST_MISSING", Password: "pa55"}
+	mon.Validate()
+	if mon.test(l) || mon.lastFailReason != "Authentication failed: environment variable CACHET_TEST_MISSING (username) is not set" {
+		t.Errorf("unexpected fail reason: %s", mon.lastFailReason)
+	}
+
+	mon.Auth = &HTTPAuth{Type: "basic", Username: "admin", UsernameFile: usernameFile}
+	if errs := mon.Validate(); len(errs) != 1 || errs[0] != "'auth': only one of 'username', 'username_env' and 'username_file' can be set" {
+		t.Errorf("unexpected validation errors: %v", errs)
+	}
+	mon.Auth = &HTTPAuth{Type: "basic", Password: "pa55"}
+	if errs := mon.Validate(); len(errs) != 1 || errs[0] != "'auth': 'username' has not been set" {
+		t.Errorf("unexpected validation errors: %v", errs)
+	}
+
+	// bearer, token from the environment
+	os.Setenv("CACHET_TEST_TOKEN", "t0k3n")
+	defer os.Unsetenv("CACHET_TEST_TOKEN")
+	mon.Auth = &HTTPAuth{Type: "bearer", TokenEnv: "CACHET_TEST_TOKEN"}
+	mon.Validate()
+	if !mon.test(l) {
+		t.Errorf("check should have passed: %s", mon.lastFailReason)
+	}
+
+	// oauth2, the token is cached
+	mon.Auth = &HTTPAuth{Type: "oauth2", TokenURL: server.URL + "/token", ClientID: "monitor", ClientSecret: "s3cr3t", Scopes: []string{"status:read"}}
+	mon.Validate()
+	if !mon.test(l) || !mon.test(l) {
+		t.Errorf("check should have passed: %s", mon.lastFailReason)
+	}
+	if tokens != 1 {
+		t.Errorf("expected a single token request, got %d", tokens)
+	}
+
+	mon.Auth = &HTTPAuth{Type: "oauth2", TokenURL: server.URL + "/token", ClientID: "monitor", ClientSecret: "wrong"}
+	mon.Validate()
+	if mon.test(l) || mon.lastFailReason != "OAuth2 token request failed: token endpoint returned HTTP status 401 (invalid_client bad credentials)" {
+		t.Errorf("unexpected fail reason: %s", mon.lastFailReason)
+	}
+
+	mon.Auth = &HTTPAuth{Type: "bearer", Token: "t0k3n", TokenFile: file}
+	if errs := mon.Validate(); len(errs) != 1 || errs[0] != "'auth': only one of 'token', 'token_env' and 'token_file' can be set" {
+		t.Errorf("unexpected validation errors: %v", errs)
+	}
+}
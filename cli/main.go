@@ -27,6 +27,7 @@ const usage = `cachet-monitor
 Usage:
   cachet-monitor (-c PATH | --config PATH)
   cachet-monitor (-c PATH | --config PATH) [--log=LOGPATH] [--name=NAME] [--immediate] [--config-test] [--log-level=LOGLEVEL]
+  cachet-monitor --store-server=ADDR [--store-token=TOKEN] [--log=LOGPATH]
   cachet-monitor -h | --help | --version
 
 Options:
@@ -37,18 +38,23 @@ Options:
   [--config-test]                Check configuration file
   [--version]                    Show version
   [--immediate]                  Tick immediately (by default waits for first defined interval)
+  [--store-server]               Run the key/value store shared by several instances (quorum)
+  [--store-token]                Token required by the key/value store
 
 Arguments:
   PATH     path to config.json
   LOGLEVEL log level (debug, info, warn, error or fatal)
   LOGPATH  path to log output (defaults to STDOUT)
   NAME     name of this logger
+  ADDR     listen address of the key/value store (e.g. :8500)
+  TOKEN    bearer token expected from the instances
 
 Examples:
   cachet-monitor -c /root/cachet-monitor.json
   cachet-monitor -c /root/cachet-monitor.json --config-test
   cachet-monitor -c /root/cachet-monitor.json --log=/var/log/cachet-monitor.log --name="development machine"
   cachet-monitor -c /root/cachet-monitor.json --log=/var/log/cachet-monitor.log
+  cachet-monitor --store-server=:8500 --store-token=secret
 
 Environment variables:
   CACHET_API      override API url from configuration
@@ -63,6 +69,13 @@ func main() {
 
 	logrus.SetOutput(getLogger(arguments["--log"]))
 
+	if addr, ok := arguments["--store-server"].(string); ok && len(addr) > 0 {
+		token, _ := arguments["--store-token"].(string)
+
+		logrus.Infof("Key/value store listening on %s", addr)
+		logrus.Fatal(http.ListenAndServe(addr, cachet.NewKVServer(token)))
+	}
+
 	cfg, err := getConfiguration(arguments["--config"].(string))
 	if err != nil {
 		logrus.Panicf("Unable to start (reading config): %v", err)
@@ -127,6 +140,18 @@ func main() {
 	}
 	logrus.Infof("Ping OK")
 
+	if cfg.HA != nil {
+		logrus.Infof("HA: replica %s, lease %ds", cfg.HA.ID, cfg.HA.Lease)
+		cfg.HA.Start()
+	}
+
+	if len(cfg.Listen) > 0 {
+		go func() {
+			logrus.Infof("Listening on %s", cfg.Listen)
+			logrus.Fatal(http.ListenAndServe(cfg.Listen, cfg.Handler()))
+		}()
+	}
+
 	wg := &sync.WaitGroup{}
 	for index, monitor := range cfg.Monitors {
 		logrus.Infof("Starting Monitor #%d: ", index)
@@ -150,6 +175,11 @@ func main() {
 	}
 
 	wg.Wait()
+	cfg.WaitHooks()
+
+	if cfg.HA != nil {
+		cfg.HA.Stop()
+	}
 }
 
 func getLogger(logPath interface{}) *os.File {
@@ -225,6 +255,42 @@ func getConfiguration(path string) (*cachet.CachetMonitor, error) {
 				var s cachet.MockMonitor
 				err = mapstructure.Decode(rawMonitor, &s)
 				t = &s
+			case "heartbeat":
+				var s cachet.HeartbeatMonitor
+				err = mapstructure.Decode(rawMonitor, &s)
+				t = &s
+			case "exec":
+				var s cachet.ExecMonitor
+				err = mapstructure.Decode(rawMonitor, &s)
+				t = &s
+			case "smtp", "imap", "pop3":
+				var s cachet.MailMonitor
+				err = mapstructure.Decode(rawMonitor, &s)
+				t = &s
+			case "postgres", "mysql", "redis":
+				var s cachet.DatabaseMonitor
+				err = mapstructure.Decode(rawMonitor, &s)
+				t = &s
+			case "grpc":
+				var s cachet.GRPCMonitor
+				err = mapstructure.Decode(rawMonitor, &s)
+				t = &s
+			case "websocket":
+				var s cachet.WebSocketMonitor
+				err = mapstructure.Decode(rawMonitor, &s)
+				t = &s
+			case "http_scenario":
+				var s cachet.HTTPScenarioMonitor
+				err = mapstructure.Decode(rawMonitor, &s)
+				t = &s
+			case "udp":
+				var s cachet.UDPMonitor
+				err = mapstructure.Decode(rawMonitor, &s)
+				t = &s
+			case "ntp":
+				var s cachet.NTPMonitor
+				err = mapstructure.Decode(rawMonitor, &s)
+				t = &s
 			default:
 				logrus.Errorf("Invalid monitor type (index: %d) %v", index, monType)
 				continue
@@ -4,6 +4,7 @@ import (
 	"net"
 	"os"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/Sirupsen/logrus"
@@ -15,8 +16,30 @@ type CachetMonitor struct {
 	API         CachetAPI                `json:"api"`
 	RawMonitors []map[string]interface{} `json:"monitors" yaml:"monitors"`
 
+	// Maintenance windows applying to every monitor (or to the listed components)
+	Maintenance []MaintenanceWindow `json:"maintenance" yaml:"maintenance"`
+	// Honour Cachet scheduled maintenances
+	CachetSchedules bool `json:"cachet_schedules" yaml:"cachet_schedules"`
+	// Multi-location coordination
+	Quorum *QuorumConfig `json:"quorum" yaml:"quorum"`
+	// Leader election between replicas
+	HA *HAConfig `json:"ha" yaml:"ha"`
+	// Listen address of the daemon's HTTP endpoints (heartbeats)
+	Listen string `json:"listen" yaml:"listen"`
+	// Maximum number of shell hooks running at the same time
+	HookConcurrency int `json:"hook_concurrency" yaml:"hook_concurrency"`
+
 	Monitors  []MonitorInterface `json:"-" yaml:"-"`
 	Immediate bool               `json:"-" yaml:"-"`
+
+	schedulesMu       sync.Mutex
+	schedules         []Schedule
+	schedulesFetched  time.Time
+	schedulesFetching bool
+
+	hooksOnce sync.Once
+	hooks     chan struct{}
+	hooksWg   sync.WaitGroup
 }
 
 // Validate configuration
@@ -37,16 +60,49 @@ func (cfg *CachetMonitor) Validate() bool {
 		valid = false
 	}
 
+	if cfg.API.Proxy != nil {
+		if errs := cfg.API.Proxy.Validate(); len(errs) > 0 {
+			logrus.Warnf("API proxy validation errors: %v", "\n - "+strings.Join(errs, "\n - "))
+			valid = false
+		}
+	}
+
 	if len(cfg.Monitors) == 0 {
 		logrus.Warnf("No monitors defined!\nSee help for example configuration")
 		valid = false
 	}
 
+	for index := range cfg.Maintenance {
+		if errs := cfg.Maintenance[index].Validate(); len(errs) > 0 {
+			logrus.Warnf("Maintenance window validation errors (index %d): %v", index, "\n - "+strings.Join(errs, "\n - "))
+			valid = false
+		}
+	}
+
+	if cfg.Quorum != nil {
+		if errs := cfg.Quorum.Validate(); len(errs) > 0 {
+			logrus.Warnf("Quorum validation errors: %v", "\n - "+strings.Join(errs, "\n - "))
+			valid = false
+		}
+	}
+
+	if cfg.HA != nil {
+		if errs := cfg.HA.Validate(cfg.SystemName); len(errs) > 0 {
+			logrus.Warnf("HA validation errors: %v", "\n - "+strings.Join(errs, "\n - "))
+			valid = false
+		}
+	}
+
 	for index, monitor := range cfg.Monitors {
 		if errs := monitor.Validate(); len(errs) > 0 {
 			logrus.Warnf("Monitor validation errors (index %d): %v", index, "\n - "+strings.Join(errs, "\n - "))
 			valid = false
 		}
+
+		if _, ok := monitor.(*HeartbeatMonitor); ok && len(cfg.Listen) == 0 {
+			logrus.Warnf("Monitor validation errors (index %d): heartbeat monitors require 'listen' to be set", index)
+			valid = false
+		}
 	}
 
 	return valid
@@ -84,6 +140,7 @@ func getTemplateData(monitor *AbstractMonitor) map[string]interface{} {
 		"SystemName": monitor.config.SystemName,
 		"API":        monitor.config.API,
 		"Monitor":    monitor,
+		"Locations":  monitor.failingLocations,
 		"now":        time.Now().Format(monitor.config.DateFormat),
 	}
 }
@@ -0,0 +1,204 @@
+package cachet
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/Sirupsen/logrus"
+)
+
+// HTTPContent detects changes of a response body (defacement, accidental publishes)
+// by comparing its SHA-256 to a pinned hash or to the first one seen (kept in Store if set)
+type HTTPContent struct {
+	// Sub-document of a JSON body which is hashed (re-encoded, so formatting is ignored)
+	JSONPath string `mapstructure:"json_path"`
+	// Regexps of volatile regions (dates, nonces...) removed before hashing
+	Ignore        []string
+	ignoreRegexps []*regexp.Regexp
+
+	// Pinned SHA-256 (hex), the first hash seen is the reference otherwise
+	Hash     string
+	baseline string
+
+	// A new hash seen that many checks in a row becomes the reference (not pinned hashes only)
+	RebaselineAfter int `mapstructure:"rebaseline_after"`
+	candidate       string
+	candidateCount  int
+
+	// Keeps the learnt reference across restarts (not pinned hashes only)
+	Store *StoreConfig
+	store Store
+	// Key of the reference in the store, set by the monitor
+	key string
+
+	// A change sets the component to partial outage instead of major outage
+	Partial bool
+}
+
+// digest returns the SHA-256 of the relevant part of body
+func (content *HTTPContent) digest(body []byte) (string, error) {
+	data := string(body)
+
+	if len(content.JSONPath) > 0 {
+		var doc interface{}
+		if err := json.Unmarshal(body, &doc); err != nil {
+			return "", errors.New("invalid JSON: " + err.Error())
+		}
+		value, err := jsonPathLookup(doc, content.JSONPath)
+		if err != nil {
+			return "", err
+		}
+		encoded, _ := json.Marshal(value)
+		data = string(encoded)
+	}
+
+	for _, exp := range content.ignoreRegexps {
+		data = exp.ReplaceAllString(data, "")
+	}
+
+	sum := sha256.Sum256([]byte(data))
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// check returns the fail reason and severity when the content changed
+func (content *HTTPContent) check(l *logrus.Entry, body []byte) (string, int) {
+	hash, err := content.digest(body)
+	if err != nil {
+		return "Could not hash content: " + err.Error(), 0
+	}
+
+	reference := content.Hash
+	if len(reference) == 0 {
+		if len(content.baseline) == 0 {
+			baseline, err := content.loadBaseline(hash)
+			if err != nil {
+				return "Could not load content reference: " + err.Error(), 0
+			}
+			content.baseline = baseline
+		}
+		reference = content.baseline
+	}
+
+	if hash == reference {
+		content.candidate, content.candidateCount = "", 0
+		return "", 0
+	}
+
+	if len(content.Hash) == 0 && content.RebaselineAfter > 0 {
+		if hash == content.candidate {
+			content.candidateCount++
+		} else {
+			content.candidate, content.candidateCount = hash, 1
+		}
+		if content.candidateCount >= content.RebaselineAfter {
+			l.Infof("Content unchanged for %d checks, new reference: sha256 %s", content.candidateCount, hash)
+			content.baseline = hash
+			content.candidate, content.candidateCount = "", 0
+			if content.store != nil {
+				if err := content.store.Put(content.key, []byte(hash)); err != nil {
+					l.Warnf("Could not store the new content reference: %v", err)
+				}
+			}
+			return "", 0
+		}
+	}
+
+	severity := 0
+	if content.Partial {
+		severity = 3
+	}
+
+	return "Content changed: sha256 " + hash + ", expected " + reference, severity
+}
+
+// loadBaseline returns the stored reference, storing hash when there is none yet
+func (content *HTTPContent) loadBaseline(hash string) (string, error) {
+	if content.store == nil {
+		return hash, nil
+	}
+
+	stored, err := content.store.Get(content.key)
+	if err != nil {
+		return "", err
+	}
+	if baseline := strings.TrimSpace(string(stored)); len(baseline) > 0 {
+		return baseline, nil
+	}
+
+	if err := content.store.Put(content.key, []byte(hash)); err != nil {
+		return "", err
+	}
+
+	return hash, nil
+}
+
+// Validate compiles the ignored regions
+func (content *HTTPContent) Validate() []string {
+	errs := []string{}
+
+	content.Hash = strings.ToLower(strings.TrimSpace(content.Hash))
+	if len(content.Hash) > 0 {
+		if decoded, err := hex.DecodeString(content.Hash); err != nil || len(decoded) != sha256.Size {
+			errs = append(errs, "'content': 'hash' is not a SHA-256 (64 hex characters)")
+		}
+	}
+
+	if content.RebaselineAfter < 0 {
+		content.RebaselineAfter = 0
+	}
+	if content.RebaselineAfter > 0 && len(content.Hash) > 0 {
+		errs = append(errs, "'content': 'rebaseline_after' does not apply to a pinned 'hash'")
+	}
+
+	content.store = nil
+	if content.Store != nil {
+		if len(content.Hash) > 0 {
+			errs = append(errs, "'content': 'store' does not apply to a pinned 'hash'")
+		} else if store, err := content.Store.Open(); err != nil {
+			errs = append(errs, "'content': "+err.Error())
+		} else {
+			content.store = store
+		}
+	}
+
+	if len(content.JSONPath) > 0 {
+		if _, err := parseJSONPath(content.JSONPath); err != nil {
+			errs = append(errs, "'content': invalid 'json_path': "+err.Error())
+		}
+	}
+
+	content.ignoreRegexps = []*regexp.Regexp{}
+	for _, ignore := range content.Ignore {
+		exp, err := regexp.Compile(ignore)
+		if err != nil {
+			errs = append(errs, "'content': Regexp compilation failure: "+err.Error())
+			continue
+		}
+		content.ignoreRegexps = append(content.ignoreRegexps, exp)
+	}
+
+	return errs
+}
+
+func (content *HTTPContent) String() string {
+	if len(content.Hash) > 0 {
+		return "pinned to " + content.Hash
+	}
+
+	if content.Store != nil && content.RebaselineAfter > 0 {
+		return "changes detected (stored reference, new reference after " + strconv.Itoa(content.RebaselineAfter) + " identical checks)"
+	}
+	if content.Store != nil {
+		return "changes detected (stored reference)"
+	}
+	if content.RebaselineAfter > 0 {
+		return "changes detected (new reference after " + strconv.Itoa(content.RebaselineAfter) + " identical checks)"
+	}
+
+	return "changes detected"
+}
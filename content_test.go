@@ -0,0 +1,117 @@
+package cachet
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Sirupsen/logrus"
+)
+
+func TestHTTPMonitorContent(t *testing.T) {
+	body := `<html><p>Welcome</p><small>generated at 10:02:11</small></html>`
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(body))
+	}))
+	defer server.Close()
+
+	l := logrus.WithFields(logrus.Fields{})
+	mon := &HTTPMonitor{}
+	mon.Name, mon.Target, mon.ComponentID, mon.Timeout = "http", server.URL, 1, 1
+	mon.Content = &HTTPContent{Ignore: []string{`generated at [0-9:]+`}, Partial: true}
+	if errs := mon.Validate(); len(errs) > 0 {
+		t.Fatalf("unexpected validation errors: %v", errs)
+	}
+
+	if !mon.test(l) {
+		t.Errorf("check should have passed: %s", mon.lastFailReason)
+	}
+
+	body = `<html><p>Welcome</p><small>generated at 10:03:12</small></html>`
+	if !mon.test(l) {
+		t.Errorf("volatile region should be ignored: %s", mon.lastFailReason)
+	}
+
+	body = `<html><p>Hacked</p><small>generated at 10:04:13</small></html>`
+	if mon.test(l) || !strings.HasPrefix(mon.lastFailReason, "Content changed: sha256 ") || mon.severity != 3 {
+		t.Errorf("unexpected fail reason: %s (severity %d)", mon.lastFailReason, mon.severity)
+	}
+
+	// JSON sub-document, formatting ignored, pinned hash
+	body = `{"version": "1.2", "config": {"debug": false}}`
+	mon.Content = &HTTPContent{JSONPath: "$.config"}
+	mon.Validate()
+	hash, _ := mon.Content.digest([]byte(`{"config":{"debug":false}}`))
+	mon.Content.Hash = hash
+	mon.Validate()
+	if !mon.test(l) {
+		t.Errorf("check should have passed: %s", mon.lastFailReason)
+	}
+
+	body = `{"version": "1.3", "config": {"debug": true}}`
+	changed, _ := mon.Content.digest([]byte(`{"config":{"debug":true}}`))
+	mon.severity = 0
+	if mon.test(l) || mon.lastFailReason != "Content changed: sha256 "+changed+", expected "+hash || mon.severity != 0 {
+		t.Errorf("unexpected fail reason: %s (severity %d)", mon.lastFailReason, mon.severity)
+	}
+
+	// a new content seen 3 checks in a row becomes the reference
+	body = `<html><p>Welcome</p></html>`
+	mon.Content = &HTTPContent{RebaselineAfter: 3}
+	mon.Validate()
+	mon.test(l)
+	body = `<html><p>Welcome back</p></html>`
+	for i := 1; i < 3; i++ {
+		if mon.test(l) {
+			t.Errorf("check %d should have failed before the new reference is accepted", i)
+		}
+	}
+	if !mon.test(l) || !mon.test(l) {
+		t.Errorf("new content should have become the reference: %s", mon.lastFailReason)
+	}
+	body = `<html><p>Welcome</p></html>`
+	if mon.test(l) {
+		t.Error("former content should now be a change")
+	}
+
+	// the stored reference survives a restart
+	store := &StoreConfig{Type: "file", Path: t.TempDir()}
+	body = `<html><p>Welcome</p></html>`
+	mon.Content = &HTTPContent{Store: store, RebaselineAfter: 2}
+	mon.Validate()
+	if !mon.test(l) {
+		t.Errorf("check should have passed: %s", mon.lastFailReason)
+	}
+
+	body = `<html><p>Hacked</p></html>`
+	mon.Content = &HTTPContent{Store: store, RebaselineAfter: 2}
+	mon.Validate()
+	if mon.test(l) || !strings.HasPrefix(mon.lastFailReason, "Content changed: sha256 ") {
+		t.Errorf("change made while stopped should be detected: %s", mon.lastFailReason)
+	}
+	if !mon.test(l) {
+		t.Errorf("new content should have become the reference: %s", mon.lastFailReason)
+	}
+
+	mon.Content = &HTTPContent{Store: store}
+	mon.Validate()
+	if !mon.test(l) {
+		t.Errorf("new reference should have been stored: %s", mon.lastFailReason)
+	}
+
+	mon.Content = &HTTPContent{Hash: hash, Store: store}
+	if errs := mon.Validate(); len(errs) != 1 || errs[0] != "'content': 'store' does not apply to a pinned 'hash'" {
+		t.Errorf("unexpected validation errors: %v", errs)
+	}
+
+	mon.Content = &HTTPContent{Hash: hash, RebaselineAfter: 3}
+	if errs := mon.Validate(); len(errs) != 1 || errs[0] != "'content': 'rebaseline_after' does not apply to a pinned 'hash'" {
+		t.Errorf("unexpected validation errors: %v", errs)
+	}
+
+	mon.Content = &HTTPContent{Hash: "abc"}
+	if errs := mon.Validate(); len(errs) != 1 || errs[0] != "'content': 'hash' is not a SHA-256 (64 hex characters)" {
+		t.Errorf("unexpected validation errors: %v", errs)
+	}
+}
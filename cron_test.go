@@ -0,0 +1,75 @@
+package cachet
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseCron(t *testing.T) {
+	for _, expr := range []string{"* * * * *", "*/5 6-22 * * mon-fri", "0 0 1,15 * *", "@daily", "30 2 * jan,jul 7"} {
+		if _, err := ParseCron(expr); err != nil {
+			t.Errorf("expression `%s` should be valid: %v", expr, err)
+		}
+	}
+
+	for _, expr := range []string{"", "* * * *", "60 * * * *", "* * * * foo", "*/0 * * * *", "10-5 * * * *"} {
+		if _, err := ParseCron(expr); err == nil {
+			t.Errorf("expression `%s` should be invalid", expr)
+		}
+	}
+}
+
+func TestCronNext(t *testing.T) {
+	c, _ := ParseCron("*/15 6-22 * * mon-fri")
+
+	// friday 22:50 -> monday 06:00
+	from := time.Date(2018, 6, 1, 22, 50, 0, 0, time.UTC)
+	if next := c.Next(from); !next.Equal(time.Date(2018, 6, 4, 6, 0, 0, 0, time.UTC)) {
+		t.Errorf("unexpected next occurrence: %v", next)
+	}
+
+	if next := c.Next(time.Date(2018, 6, 4, 6, 0, 0, 0, time.UTC)); !next.Equal(time.Date(2018, 6, 4, 6, 15, 0, 0, time.UTC)) {
+		t.Errorf("next occurrence must be strictly after the given time: %v", next)
+	}
+}
+
+func TestMaintenanceWindowActive(t *testing.T) {
+	w := MaintenanceWindow{Cron: "0 2 * * sun", Duration: 3600}
+	if errs := w.Validate(); len(errs) > 0 {
+		t.Fatalf("unexpected validation errors: %v", errs)
+	}
+
+	// 2018-06-03 is a sunday
+	if !w.Active(time.Date(2018, 6, 3, 2, 30, 0, 0, time.Local)) {
+		t.Error("window should be active at 02:30")
+	}
+	if w.Active(time.Date(2018, 6, 3, 3, 0, 0, 0, time.Local)) {
+		t.Error("window should be over at 03:00")
+	}
+
+	w = MaintenanceWindow{Start: "2018-06-03 10:00", End: "2018-06-03 12:00"}
+	if errs := w.Validate(); len(errs) > 0 {
+		t.Fatalf("unexpected validation errors: %v", errs)
+	}
+	if !w.Active(time.Date(2018, 6, 3, 11, 0, 0, 0, time.Local)) || w.Active(time.Date(2018, 6, 3, 12, 0, 0, 0, time.Local)) {
+		t.Error("absolute window boundaries are not honoured")
+	}
+}
+
+func TestActiveWindow(t *testing.T) {
+	w := ActiveWindow{Days: "mon-fri", From: "22:00", To: "06:00"}
+	if errs := w.Validate(); len(errs) > 0 {
+		t.Fatalf("unexpected validation errors: %v", errs)
+	}
+
+	// 2018-06-01 is a friday, 2018-06-02 a saturday
+	if !w.Active(time.Date(2018, 6, 1, 23, 0, 0, 0, time.Local)) {
+		t.Error("window should be active on friday 23:00")
+	}
+	if !w.Active(time.Date(2018, 6, 2, 5, 59, 0, 0, time.Local)) {
+		t.Error("window started on friday should span until saturday 06:00")
+	}
+	if w.Active(time.Date(2018, 6, 2, 23, 0, 0, 0, time.Local)) {
+		t.Error("window should not be active on saturday evening")
+	}
+}
@@ -0,0 +1,258 @@
+package cachet
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/go-sql-driver/mysql"
+	"github.com/gomodule/redigo/redis"
+	_ "github.com/lib/pq"
+)
+
+// Default query (command for redis) per database type
+var defaultDatabaseQueries = map[string]string{
+	"postgres": "SELECT 1",
+	"mysql":    "SELECT 1",
+	"redis":    "PING",
+}
+
+// DatabaseMonitor connects to a PostgreSQL, MySQL or Redis server (see Type) and runs a query
+type DatabaseMonitor struct {
+	AbstractMonitor `mapstructure:",squash"`
+
+	// Target is the DSN (postgres:// URL or key=value, mysql DSN, redis:// URL or host:port),
+	// credentials are better kept out of it (Target is logged)
+	Username string
+	Password string
+
+	// SQL query (first column of the first row is used) or redis command
+	Query string
+
+	// The result has to be equal to ExpectedResult...
+	ExpectedResult string `mapstructure:"expected_result"`
+	// ...and/or within these bounds (down)
+	ResultMin *float64 `mapstructure:"result_min"`
+	ResultMax *float64 `mapstructure:"result_max"`
+	// ...and within these bounds (partial outage)
+	ResultWarningMin *float64 `mapstructure:"result_warning_min"`
+	ResultWarningMax *float64 `mapstructure:"result_warning_max"`
+}
+
+func (monitor *DatabaseMonitor) test(l *logrus.Entry) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), monitor.Timeout*time.Second)
+	defer cancel()
+
+	var result string
+	var err error
+	if monitor.Type == "redis" {
+		result, err = monitor.queryRedis(ctx)
+	} else {
+		result, err = monitor.querySQL(ctx)
+	}
+
+	if err != nil {
+		monitor.lastFailReason = err.Error()
+		l.Infof("Database error: %s", monitor.lastFailReason)
+		return false
+	}
+
+	if reason, severity := monitor.checkResult(result); len(reason) > 0 {
+		monitor.lastFailReason = reason
+		monitor.severity = severity
+		l.Infof("%s", monitor.lastFailReason)
+		return false
+	}
+
+	monitor.triggerShellHook(l, "on_success", monitor.ShellHookOnSuccess, result)
+
+	return true
+}
+
+func (monitor *DatabaseMonitor) querySQL(ctx context.Context) (string, error) {
+	db, err := sql.Open(monitor.Type, monitor.dsn())
+	if err != nil {
+		return "", err
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	rows, err := db.QueryContext(ctx, monitor.Query)
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return "", err
+	}
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return "", err
+		}
+		return "", errors.New("Query returned no rows")
+	}
+
+	values := make([]interface{}, len(columns))
+	for i := range values {
+		values[i] = new(sql.RawBytes)
+	}
+	if err := rows.Scan(values...); err != nil {
+		return "", err
+	}
+
+	return string(*values[0].(*sql.RawBytes)), nil
+}
+
+// dsn adds the credentials to the target
+func (monitor *DatabaseMonitor) dsn() string {
+	if len(monitor.Username) == 0 && len(monitor.Password) == 0 {
+		return monitor.Target
+	}
+
+	switch monitor.Type {
+	case "mysql":
+		if cfg, err := mysql.ParseDSN(monitor.Target); err == nil {
+			cfg.User, cfg.Passwd = monitor.Username, monitor.Password
+			return cfg.FormatDSN()
+		}
+	case "postgres":
+		if u, err := url.Parse(monitor.Target); err == nil && (u.Scheme == "postgres" || u.Scheme == "postgresql") {
+			u.User = url.UserPassword(monitor.Username, monitor.Password)
+			return u.String()
+		}
+
+		quote := strings.NewReplacer(`\`, `\\`, `'`, `\'`)
+		return monitor.Target + " user='" + quote.Replace(monitor.Username) + "' password='" + quote.Replace(monitor.Password) + "'"
+	}
+
+	return monitor.Target
+}
+
+func (monitor *DatabaseMonitor) queryRedis(ctx context.Context) (string, error) {
+	options := []redis.DialOption{}
+	if len(monitor.Username) > 0 {
+		options = append(options, redis.DialUsername(monitor.Username))
+	}
+	if len(monitor.Password) > 0 {
+		options = append(options, redis.DialPassword(monitor.Password))
+	}
+	options = append(options, redis.DialTLSSkipVerify(!monitor.Strict))
+
+	var conn redis.Conn
+	var err error
+	if strings.Contains(monitor.Target, "://") {
+		conn, err = redis.DialURLContext(ctx, monitor.Target, options...)
+	} else {
+		conn, err = redis.DialContext(ctx, "tcp", monitor.Target, options...)
+	}
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+
+	fields := strings.Fields(monitor.Query)
+	args := make([]interface{}, len(fields)-1)
+	for i, f := range fields[1:] {
+		args[i] = f
+	}
+
+	reply, err := redis.DoContext(conn, ctx, fields[0], args...)
+	if err != nil {
+		return "", err
+	}
+
+	switch r := reply.(type) {
+	case int64:
+		return strconv.FormatInt(r, 10), nil
+	case nil:
+		return "", errors.New("Command returned nil")
+	case []interface{}:
+		if len(r) == 0 {
+			return "", errors.New("Command returned an empty array")
+		}
+		return redis.String(r[0], nil)
+	}
+
+	return redis.String(reply, nil)
+}
+
+// checkResult compares the result to the expectations, returning the fail reason and severity
+func (monitor *DatabaseMonitor) checkResult(result string) (string, int) {
+	if len(monitor.ExpectedResult) > 0 && result != monitor.ExpectedResult {
+		return "Unexpected result: " + result + ", expected: " + monitor.ExpectedResult, 0
+	}
+
+	if monitor.ResultMin == nil && monitor.ResultMax == nil && monitor.ResultWarningMin == nil && monitor.ResultWarningMax == nil {
+		return "", 0
+	}
+
+	value, err := strconv.ParseFloat(strings.TrimSpace(result), 64)
+	if err != nil {
+		return "Result is not a number: " + result, 0
+	}
+
+	if monitor.ResultMin != nil && value < *monitor.ResultMin {
+		return "Result " + result + " below " + formatFloat(*monitor.ResultMin), 4
+	}
+	if monitor.ResultMax != nil && value > *monitor.ResultMax {
+		return "Result " + result + " above " + formatFloat(*monitor.ResultMax), 4
+	}
+	if monitor.ResultWarningMin != nil && value < *monitor.ResultWarningMin {
+		return "Result " + result + " below " + formatFloat(*monitor.ResultWarningMin) + " (warning)", 3
+	}
+	if monitor.ResultWarningMax != nil && value > *monitor.ResultWarningMax {
+		return "Result " + result + " above " + formatFloat(*monitor.ResultWarningMax) + " (warning)", 3
+	}
+
+	return "", 0
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+func (mon *DatabaseMonitor) Validate() []string {
+	mon.Template.Investigating.SetDefault(defaultHTTPInvestigatingTpl)
+	mon.Template.Fixed.SetDefault(defaultHTTPFixedTpl)
+
+	errs := mon.AbstractMonitor.Validate()
+
+	if len(mon.Target) == 0 {
+		errs = append(errs, "'Target' has not been set")
+	}
+
+	if len(strings.TrimSpace(mon.Query)) == 0 {
+		mon.Query = defaultDatabaseQueries[mon.Type]
+	}
+
+	if mon.Type == "mysql" && len(mon.Target) > 0 {
+		if _, err := mysql.ParseDSN(mon.Target); err != nil {
+			errs = append(errs, "Invalid mysql DSN: "+err.Error())
+		}
+	}
+
+	return errs
+}
+
+func (mon *DatabaseMonitor) Describe() []string {
+	features := mon.AbstractMonitor.Describe()
+	features = append(features, "Query: "+mon.Query)
+	if len(mon.Username) > 0 {
+		features = append(features, "Authenticated as: "+mon.Username)
+	}
+	if len(mon.ExpectedResult) > 0 {
+		features = append(features, "Expected result: "+mon.ExpectedResult)
+	}
+	if mon.ResultMin != nil || mon.ResultMax != nil || mon.ResultWarningMin != nil || mon.ResultWarningMax != nil {
+		features = append(features, "Result thresholds set")
+	}
+
+	return features
+}
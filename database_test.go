@@ -0,0 +1,116 @@
+package cachet
+
+import (
+	"bufio"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/Sirupsen/logrus"
+)
+
+func TestDatabaseCheckResult(t *testing.T) {
+	max, warning := 30.0, 10.0
+	mon := &DatabaseMonitor{ResultMax: &max, ResultWarningMax: &warning}
+
+	for _, tc := range []struct {
+		result   string
+		reason   string
+		severity int
+	}{
+		{"2", "", 0},
+		{"12.5", "Result 12.5 above 10 (warning)", 3},
+		{"31", "Result 31 above 30", 4},
+		{"lag", "Result is not a number: lag", 0},
+	} {
+		if reason, severity := mon.checkResult(tc.result); reason != tc.reason || severity != tc.severity {
+			t.Errorf("%s: got %q (%d)", tc.result, reason, severity)
+		}
+	}
+
+	mon = &DatabaseMonitor{ExpectedResult: "PONG"}
+	if reason, _ := mon.checkResult("LOADING"); reason != "Unexpected result: LOADING, expected: PONG" {
+		t.Errorf("unexpected reason: %s", reason)
+	}
+}
+
+func TestDatabaseDSN(t *testing.T) {
+	mon := &DatabaseMonitor{Username: "monitor", Password: "p@ss'"}
+
+	mon.Type, mon.Target = "postgres", "postgres://db:5432/app?sslmode=disable"
+	if dsn := mon.dsn(); dsn != "postgres://monitor:p%40ss%27@db:5432/app?sslmode=disable" {
+		t.Errorf("unexpected dsn: %s", dsn)
+	}
+
+	mon.Target = "host=db dbname=app"
+	if dsn := mon.dsn(); dsn != `host=db dbname=app user='monitor' password='p@ss\''` {
+		t.Errorf("unexpected dsn: %s", dsn)
+	}
+
+	mon.Type, mon.Target = "mysql", "tcp(db:3306)/app"
+	if dsn := mon.dsn(); !strings.HasPrefix(dsn, "monitor:p@ss'@tcp(db:3306)/app") {
+		t.Errorf("unexpected dsn: %s", dsn)
+	}
+}
+
+func TestDatabaseMonitorRedis(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	// answers AUTH then PING, rejecting the "wrong" password
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				r := bufio.NewReader(conn)
+				for {
+					line, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+					if !strings.HasPrefix(line, "*") {
+						continue
+					}
+					args := []string{}
+					for i := 0; i < int(line[1]-'0'); i++ {
+						r.ReadString('\n')
+						arg, _ := r.ReadString('\n')
+						args = append(args, strings.TrimSpace(arg))
+					}
+
+					switch {
+					case args[0] == "AUTH" && args[len(args)-1] == "wrong":
+						conn.Write([]byte("-WRONGPASS invalid username-password pair\r\n"))
+					case args[0] == "PING":
+						conn.Write([]byte("+PONG\r\n"))
+					default:
+						conn.Write([]byte("+OK\r\n"))
+					}
+				}
+			}()
+		}
+	}()
+
+	l := logrus.WithFields(logrus.Fields{})
+	mon := &DatabaseMonitor{Password: "secret", ExpectedResult: "PONG"}
+	mon.Name, mon.Type, mon.Target, mon.ComponentID = "redis", "redis", ln.Addr().String(), 1
+	if errs := mon.Validate(); len(errs) > 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+
+	if !mon.test(l) {
+		t.Errorf("check should have passed: %s", mon.lastFailReason)
+	}
+
+	mon.Password = "wrong"
+	if mon.test(l) || mon.lastFailReason != "WRONGPASS invalid username-password pair" {
+		t.Errorf("unexpected fail reason: %s", mon.lastFailReason)
+	}
+}
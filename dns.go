@@ -1,9 +1,17 @@
 package cachet
 
 import (
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"io/ioutil"
 	"net"
+	"net/http"
+	"net/url"
 	"regexp"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/Sirupsen/logrus"
 	"github.com/miekg/dns"
@@ -18,22 +26,94 @@ type DNSAnswer struct {
 type DNSMonitor struct {
 	AbstractMonitor `mapstructure:",squash"`
 
-	// IP:port format or blank to use system defined DNS
+	// IP:port format or blank to use system defined DNS (udp / tcp),
+	// host[:port] for tls, URL (https://dns.example/dns-query) for https
 	DNS string
 
+	// udp(default) / tcp / tls (DNS over TLS) / https (DNS over HTTPS)
+	Protocol string
+	// Name the certificate is verified against (tls / https), defaults to the server's host
+	ServerName string `mapstructure:"server_name"`
+	// Skips the certificate verification
+	Insecure bool
+	// Proxy used for DNS over HTTPS (direct when not set)
+	Proxy *ProxyConfig
+
 	// A(default), AAAA, MX, ...
 	Question string
 	question uint16
 
 	Answers []DNSAnswer
+	// all(default): every answer is found / any: one of them is / exactly: the records are exactly these answers
+	Match string
+	// None of the records may match these
+	UnexpectedAnswers []DNSAnswer `mapstructure:"unexpected_answers"`
+
+	// NOERROR(default), NXDOMAIN, SERVFAIL...
+	ExpectedRcode string `mapstructure:"expected_rcode"`
+	rcode         int
+
+	// Bounds of the number of records of the question type (0: no bound)
+	AnswerCountMin int `mapstructure:"answer_count_min"`
+	AnswerCountMax int `mapstructure:"answer_count_max"`
+	// Bounds of their TTL, in seconds (0: no bound)
+	TTLMin int `mapstructure:"ttl_min"`
+	TTLMax int `mapstructure:"ttl_max"`
+
+	// Servers (same format as DNS) which have to agree on the answer...
+	Servers []string
+	// ...or compare the zone's nameservers (NS records), queried without recursion
+	Authoritative bool
+	// Zone of the NS / SOA records, defaults to the target
+	Zone string
+	// Compares the SOA serials too, which may differ by SerialTolerance
+	CheckSerial     bool `mapstructure:"check_serial"`
+	SerialTolerance int  `mapstructure:"serial_tolerance"`
+
+	// ad (require the AD flag of a validating resolver) / validate (chain of trust up to TrustAnchors)
+	DNSSEC string `mapstructure:"dnssec"`
+	// DS or DNSKEY records in zone file format, the root zone KSKs by default
+	TrustAnchors []string `mapstructure:"trust_anchors"`
+	trustAnchors map[string][]*dns.DS
+	// Partial outage when a signature expires within this many days
+	SignatureExpiryWarning int `mapstructure:"signature_expiry_warning"`
 }
 
 func (monitor *DNSMonitor) Validate() []string {
+	monitor.Template.Investigating.SetDefault(defaultHTTPInvestigatingTpl)
+	monitor.Template.Fixed.SetDefault(defaultHTTPFixedTpl)
+
 	errs := monitor.AbstractMonitor.Validate()
 
+	monitor.Protocol = strings.ToLower(monitor.Protocol)
+	switch monitor.Protocol {
+	case "":
+		monitor.Protocol = "udp"
+	case "udp", "tcp":
+	case "tls":
+		if len(monitor.DNS) == 0 {
+			errs = append(errs, "'dns' is required for DNS over TLS")
+		} else if _, _, err := net.SplitHostPort(monitor.DNS); err != nil {
+			monitor.DNS = net.JoinHostPort(monitor.DNS, "853")
+		}
+	case "https":
+		if u, err := url.Parse(monitor.DNS); err != nil || u.Scheme != "https" || len(u.Host) == 0 {
+			errs = append(errs, "'dns' has to be an https:// URL for DNS over HTTPS")
+		}
+	default:
+		errs = append(errs, "Unsupported DNS protocol: "+monitor.Protocol+" (expected udp, tcp, tls or https)")
+	}
+
+	if monitor.Proxy != nil {
+		if monitor.Protocol != "https" {
+			errs = append(errs, "'proxy' only applies to DNS over HTTPS")
+		}
+		errs = append(errs, monitor.Proxy.Validate()...)
+	}
+
 	if len(monitor.DNS) == 0 {
 		config, _ := dns.ClientConfigFromFile("/etc/resolv.conf")
-		if len(config.Servers) > 0 {
+		if config != nil && len(config.Servers) > 0 {
 			monitor.DNS = net.JoinHostPort(config.Servers[0], config.Port)
 		}
 	}
@@ -52,9 +132,81 @@ func (monitor *DNSMonitor) Validate() []string {
 		errs = append(errs, "Could not look up DNS question type")
 	}
 
-	for i, a := range monitor.Answers {
-		if len(a.Regex) > 0 {
-			monitor.Answers[i].regexp, _ = regexp.Compile(a.Regex)
+	if len(monitor.Zone) == 0 {
+		monitor.Zone = monitor.Target
+	}
+	monitor.Zone = dns.Fqdn(monitor.Zone)
+	if monitor.CheckSerial && !monitor.checksConsistency() {
+		errs = append(errs, "'check_serial' needs 'servers' or 'authoritative'")
+	}
+	if monitor.SerialTolerance < 0 {
+		errs = append(errs, "'serial_tolerance' cannot be negative")
+	}
+	for _, server := range monitor.Servers {
+		if monitor.Protocol == "https" {
+			if u, err := url.Parse(server); err != nil || u.Scheme != "https" {
+				errs = append(errs, "Server "+server+" has to be an https:// URL")
+			}
+		} else if _, _, err := net.SplitHostPort(server); err != nil {
+			errs = append(errs, "Server "+server+" has to be in host:port format")
+		}
+	}
+
+	monitor.DNSSEC = strings.ToLower(monitor.DNSSEC)
+	switch monitor.DNSSEC {
+	case "", "ad":
+	case "validate":
+		anchors := monitor.TrustAnchors
+		if len(anchors) == 0 {
+			anchors = defaultTrustAnchors
+		}
+		var err error
+		if monitor.trustAnchors, err = parseTrustAnchors(anchors); err != nil {
+			errs = append(errs, err.Error())
+		}
+	default:
+		errs = append(errs, "Unsupported 'dnssec' mode: "+monitor.DNSSEC+" (expected ad or validate)")
+	}
+	if monitor.SignatureExpiryWarning > 0 && len(monitor.DNSSEC) == 0 {
+		errs = append(errs, "'signature_expiry_warning' needs 'dnssec'")
+	}
+
+	monitor.Match = strings.ToLower(monitor.Match)
+	switch monitor.Match {
+	case "":
+		monitor.Match = "all"
+	case "all", "any", "exactly":
+	default:
+		errs = append(errs, "Unsupported 'match': "+monitor.Match+" (expected all, any or exactly)")
+	}
+
+	if len(monitor.ExpectedRcode) == 0 {
+		monitor.ExpectedRcode = "NOERROR"
+	}
+	monitor.ExpectedRcode = strings.ToUpper(monitor.ExpectedRcode)
+	rcode, ok := dns.StringToRcode[monitor.ExpectedRcode]
+	if !ok {
+		errs = append(errs, "Unknown 'expected_rcode': "+monitor.ExpectedRcode)
+	}
+	monitor.rcode = rcode
+
+	if monitor.AnswerCountMax > 0 && monitor.AnswerCountMin > monitor.AnswerCountMax {
+		errs = append(errs, "'answer_count_min' is above 'answer_count_max'")
+	}
+	if monitor.TTLMax > 0 && monitor.TTLMin > monitor.TTLMax {
+		errs = append(errs, "'ttl_min' is above 'ttl_max'")
+	}
+
+	for _, answers := range [][]DNSAnswer{monitor.Answers, monitor.UnexpectedAnswers} {
+		for i, a := range answers {
+			answers[i].regexp = nil
+			if len(a.Regex) > 0 {
+				exp, err := regexp.Compile(a.Regex)
+				if err != nil {
+					errs = append(errs, "Regexp compilation failure: "+err.Error())
+				}
+				answers[i].regexp = exp
+			}
 		}
 	}
 
@@ -65,29 +217,44 @@ func (monitor *DNSMonitor) test(l *logrus.Entry) bool {
 	m := new(dns.Msg)
 	m.SetQuestion(dns.Fqdn(monitor.Target), monitor.question)
 	m.RecursionDesired = true
+	if len(monitor.DNSSEC) > 0 {
+		m.SetEdns0(4096, true)
+		// bogus answers are validated (and explained) here rather than SERVFAIL
+		m.CheckingDisabled = monitor.DNSSEC == "validate"
+	}
 
-	c := new(dns.Client)
-	r, _, err := c.Exchange(m, monitor.DNS)
+	r, err := monitor.exchange(m, monitor.Protocol, monitor.DNS)
 	if err != nil {
-		logrus.Warnf("DNS error: %v", err)
+		monitor.lastFailReason = "DNS error: " + err.Error()
+		l.Infof("%s", monitor.lastFailReason)
 		return false
 	}
 
-	if r.Rcode != dns.RcodeSuccess {
+	if r.Rcode != monitor.rcode {
+		monitor.lastFailReason = "Expected rcode " + monitor.ExpectedRcode + ", got " + dns.RcodeToString[r.Rcode]
+		l.Infof("%s", monitor.lastFailReason)
 		return false
 	}
 
-	for _, check := range monitor.Answers {
-		found := false
-		for _, answer := range r.Answer {
-			found = matchAnswer(answer, check)
-			if found {
-				break
-			}
+	if len(monitor.DNSSEC) > 0 {
+		if reason, severity := monitor.checkDNSSEC(r); len(reason) > 0 {
+			monitor.lastFailReason = reason
+			monitor.severity = severity
+			l.Infof("%s", monitor.lastFailReason)
+			return false
 		}
+	}
+
+	if reason := monitor.checkAnswers(r.Answer); len(reason) > 0 {
+		monitor.lastFailReason = reason
+		l.Infof("DNS check failed: %s", monitor.lastFailReason)
+		return false
+	}
 
-		if !found {
-			logrus.Warnf("DNS check failed: %v. Not found in any of %v", check, r.Answer)
+	if monitor.checksConsistency() {
+		if reason := monitor.checkConsistency(); len(reason) > 0 {
+			monitor.lastFailReason = reason
+			l.Infof("DNS consistency check failed: %s", monitor.lastFailReason)
 			return false
 		}
 	}
@@ -97,6 +264,99 @@ func (monitor *DNSMonitor) test(l *logrus.Entry) bool {
 	return true
 }
 
+// exchange sends the query to server with protocol (udp, tcp, tls or https)
+func (monitor *DNSMonitor) exchange(m *dns.Msg, protocol string, server string) (*dns.Msg, error) {
+	if protocol == "https" {
+		return monitor.exchangeHTTPS(m, server)
+	}
+
+	c := &dns.Client{
+		Net:     protocol,
+		Timeout: monitor.Timeout * time.Second,
+	}
+	if protocol == "tls" {
+		c.Net = "tcp-tls"
+		c.TLSConfig = monitor.tlsConfig(server)
+	}
+
+	r, _, err := c.Exchange(m, server)
+	if err == nil && r.Truncated && protocol == "udp" {
+		c.Net = "tcp"
+		r, _, err = c.Exchange(m, server)
+	}
+
+	return r, err
+}
+
+// exchangeHTTPS sends a wire format query to a DNS over HTTPS endpoint (RFC 8484)
+func (monitor *DNSMonitor) exchangeHTTPS(m *dns.Msg, endpoint string) (*dns.Msg, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	// a zero ID is cache friendly
+	query := m.Copy()
+	query.Id = 0
+	packed, err := query.Pack()
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest("POST", endpoint, bytes.NewReader(packed))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/dns-message")
+	req.Header.Set("Accept", "application/dns-message")
+	req.Header.Set("User-Agent", "Cachet-Monitor")
+
+	client := &http.Client{
+		Timeout: monitor.Timeout * time.Second,
+		Transport: &http.Transport{
+			Proxy:           monitor.Proxy.proxyFunc(),
+			TLSClientConfig: monitor.tlsConfig(u.Host),
+		},
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return nil, errors.New("DNS over HTTPS: HTTP response status " + strconv.Itoa(resp.StatusCode))
+	}
+	if contentType := resp.Header.Get("Content-Type"); !strings.HasPrefix(contentType, "application/dns-message") {
+		return nil, errors.New("DNS over HTTPS: unexpected content type " + contentType)
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	r := new(dns.Msg)
+	if err := r.Unpack(body); err != nil {
+		return nil, errors.New("DNS over HTTPS: " + err.Error())
+	}
+	r.Id = m.Id
+
+	return r, nil
+}
+
+func (monitor *DNSMonitor) tlsConfig(server string) *tls.Config {
+	serverName := monitor.ServerName
+	if len(serverName) == 0 {
+		serverName = server
+		if host, _, err := net.SplitHostPort(server); err == nil {
+			serverName = host
+		}
+	}
+
+	return &tls.Config{ServerName: serverName, InsecureSkipVerify: monitor.Insecure}
+}
+
 func findDNSType(t string) uint16 {
 	for rr, strType := range dns.TypeToString {
 		if t == strType {
@@ -107,13 +367,18 @@ func findDNSType(t string) uint16 {
 	return 0
 }
 
-func matchAnswer(answer dns.RR, check DNSAnswer) bool {
+// answerData returns the record's data fields (no name, TTL...)
+func answerData(answer dns.RR) string {
 	fields := []string{}
 	for i := 0; i < dns.NumField(answer); i++ {
 		fields = append(fields, dns.Field(answer, i+1))
 	}
 
-	str := strings.Join(fields, " ")
+	return strings.Join(fields, " ")
+}
+
+func matchAnswer(answer dns.RR, check DNSAnswer) bool {
+	str := answerData(answer)
 
 	if check.regexp != nil {
 		return check.regexp.Match([]byte(str))
@@ -121,3 +386,32 @@ func matchAnswer(answer dns.RR, check DNSAnswer) bool {
 
 	return str == check.Exact
 }
+
+func (monitor *DNSMonitor) Describe() []string {
+	features := monitor.AbstractMonitor.Describe()
+	features = append(features, "DNS: "+monitor.DNS+" ("+monitor.Protocol+")")
+	features = append(features, "Question: "+monitor.Question)
+	if monitor.Proxy != nil {
+		features = append(features, "Proxy: "+monitor.Proxy.String())
+	}
+	if monitor.ExpectedRcode != "NOERROR" {
+		features = append(features, "Expected rcode: "+monitor.ExpectedRcode)
+	}
+	if len(monitor.Answers) > 0 {
+		features = append(features, "Answers: "+monitor.Match+" of "+strconv.Itoa(len(monitor.Answers)))
+	}
+	if monitor.Authoritative {
+		features = append(features, "Consistency: nameservers of "+monitor.Zone)
+	}
+	if len(monitor.Servers) > 0 {
+		features = append(features, "Consistency: "+strings.Join(monitor.Servers, ", "))
+	}
+	if monitor.CheckSerial {
+		features = append(features, "SOA serial tolerance: "+strconv.Itoa(monitor.SerialTolerance))
+	}
+	if len(monitor.DNSSEC) > 0 {
+		features = append(features, "DNSSEC: "+monitor.DNSSEC)
+	}
+
+	return features
+}
@@ -0,0 +1,120 @@
+package cachet
+
+import (
+	"crypto/tls"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/miekg/dns"
+)
+
+// testDNSHandler answers A questions for example.test.
+func testDNSHandler(w dns.ResponseWriter, req *dns.Msg) {
+	m := new(dns.Msg)
+	m.SetReply(req)
+	if req.Question[0].Name == "example.test." && req.Question[0].Qtype == dns.TypeA {
+		rr, _ := dns.NewRR("example.test. 300 IN A 192.0.2.1")
+		m.Answer = append(m.Answer, rr)
+	} else {
+		m.Rcode = dns.RcodeNameError
+	}
+	w.WriteMsg(m)
+}
+
+// startTestDNSServer serves handler over net (udp, tcp or tcp-tls) on a local port
+func startTestDNSServer(t *testing.T, network string, handler dns.HandlerFunc, config *tls.Config) string {
+	server := &dns.Server{Net: network, Handler: handler, TLSConfig: config}
+	started := make(chan struct{})
+	server.NotifyStartedFunc = func() { close(started) }
+
+	if network == "udp" {
+		conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		server.PacketConn = conn
+	} else {
+		var listener net.Listener
+		var err error
+		if config != nil {
+			listener, err = tls.Listen("tcp", "127.0.0.1:0", config)
+		} else {
+			listener, err = net.Listen("tcp", "127.0.0.1:0")
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		server.Listener = listener
+	}
+
+	go server.ActivateAndServe()
+	<-started
+	t.Cleanup(func() { server.Shutdown() })
+
+	if server.PacketConn != nil {
+		return server.PacketConn.LocalAddr().String()
+	}
+	return server.Listener.Addr().String()
+}
+
+func TestDNSMonitorProtocols(t *testing.T) {
+	doh := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		req := new(dns.Msg)
+		if r.Header.Get("Content-Type") != "application/dns-message" || req.Unpack(body) != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		m := new(dns.Msg)
+		m.SetReply(req)
+		rr, _ := dns.NewRR("example.test. 300 IN A 192.0.2.1")
+		m.Answer = append(m.Answer, rr)
+		packed, _ := m.Pack()
+		w.Header().Set("Content-Type", "application/dns-message")
+		w.Write(packed)
+	}))
+	defer doh.Close()
+
+	servers := map[string]string{
+		"udp":   startTestDNSServer(t, "udp", testDNSHandler, nil),
+		"tcp":   startTestDNSServer(t, "tcp", testDNSHandler, nil),
+		"tls":   startTestDNSServer(t, "tcp-tls", testDNSHandler, &tls.Config{Certificates: doh.TLS.Certificates}),
+		"https": doh.URL + "/dns-query",
+	}
+
+	l := logrus.WithFields(logrus.Fields{})
+	for protocol, server := range servers {
+		mon := &DNSMonitor{DNS: server, Protocol: protocol, Insecure: true, Answers: []DNSAnswer{{Exact: "192.0.2.1"}}}
+		mon.Name, mon.Target, mon.ComponentID, mon.Timeout = "dns", "example.test", 1, 1
+		if errs := mon.Validate(); len(errs) > 0 {
+			t.Fatalf("%s: unexpected validation errors: %v", protocol, errs)
+		}
+		if !mon.test(l) {
+			t.Errorf("%s: check should have passed", protocol)
+		}
+	}
+
+	// certificate verified by default
+	mon := &DNSMonitor{DNS: servers["tls"], Protocol: "tls"}
+	mon.Name, mon.Target, mon.ComponentID, mon.Timeout = "dns", "example.test", 1, 1
+	mon.Validate()
+	if mon.test(l) {
+		t.Error("self-signed certificate should have been rejected")
+	}
+
+	mon = &DNSMonitor{DNS: "8.8.8.8:53", Proxy: &ProxyConfig{URL: "environment"}}
+	mon.Name, mon.Target, mon.ComponentID, mon.Timeout = "dns", "example.test", 1, 1
+	if errs := mon.Validate(); len(errs) != 1 || errs[0] != "'proxy' only applies to DNS over HTTPS" {
+		t.Errorf("unexpected validation errors: %v", errs)
+	}
+
+	mon = &DNSMonitor{DNS: "dns.example.test", Protocol: "https"}
+	mon.Name, mon.Target, mon.ComponentID, mon.Timeout = "dns", "example.test", 1, 1
+	if errs := mon.Validate(); len(errs) != 1 || errs[0] != "'dns' has to be an https:// URL for DNS over HTTPS" {
+		t.Errorf("unexpected validation errors: %v", errs)
+	}
+}
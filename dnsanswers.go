@@ -0,0 +1,103 @@
+package cachet
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+func (check DNSAnswer) String() string {
+	if len(check.Regex) > 0 {
+		return "regex '" + check.Regex + "'"
+	}
+
+	return "exact '" + check.Exact + "'"
+}
+
+// formatAnswers lists the records' data for fail reasons
+func formatAnswers(records []dns.RR) string {
+	data := []string{}
+	for _, rr := range records {
+		data = append(data, answerData(rr))
+	}
+
+	return "[" + strings.Join(data, ", ") + "]"
+}
+
+// checkAnswers returns the fail reason when the records do not meet the monitor's assertions
+func (monitor *DNSMonitor) checkAnswers(records []dns.RR) string {
+	// records of the question type (no CNAME, RRSIG...)
+	answers := []dns.RR{}
+	for _, rr := range records {
+		if rr.Header().Rrtype == monitor.question {
+			answers = append(answers, rr)
+		}
+	}
+
+	if monitor.AnswerCountMin > 0 && len(answers) < monitor.AnswerCountMin {
+		return "Got " + strconv.Itoa(len(answers)) + " " + monitor.Question + " records, expected at least " + strconv.Itoa(monitor.AnswerCountMin)
+	}
+	if monitor.AnswerCountMax > 0 && len(answers) > monitor.AnswerCountMax {
+		return "Got " + strconv.Itoa(len(answers)) + " " + monitor.Question + " records, expected at most " + strconv.Itoa(monitor.AnswerCountMax)
+	}
+
+	for _, rr := range answers {
+		ttl := int(rr.Header().Ttl)
+		if monitor.TTLMin > 0 && ttl < monitor.TTLMin {
+			return "TTL of " + answerData(rr) + " is " + strconv.Itoa(ttl) + ", expected at least " + strconv.Itoa(monitor.TTLMin)
+		}
+		if monitor.TTLMax > 0 && ttl > monitor.TTLMax {
+			return "TTL of " + answerData(rr) + " is " + strconv.Itoa(ttl) + ", expected at most " + strconv.Itoa(monitor.TTLMax)
+		}
+	}
+
+	for _, check := range monitor.UnexpectedAnswers {
+		for _, rr := range records {
+			if matchAnswer(rr, check) {
+				return "Unexpected answer: " + answerData(rr) + " (matches " + check.String() + ")"
+			}
+		}
+	}
+
+	if len(monitor.Answers) == 0 {
+		return ""
+	}
+
+	found := func(check DNSAnswer) bool {
+		for _, rr := range records {
+			if matchAnswer(rr, check) {
+				return true
+			}
+		}
+		return false
+	}
+
+	switch monitor.Match {
+	case "any":
+		for _, check := range monitor.Answers {
+			if found(check) {
+				return ""
+			}
+		}
+		return "None of the expected answers found in " + formatAnswers(records)
+	case "exactly":
+		for _, rr := range answers {
+			expected := false
+			for _, check := range monitor.Answers {
+				expected = expected || matchAnswer(rr, check)
+			}
+			if !expected {
+				return "Unexpected answer: " + answerData(rr) + " (not in the expected answers)"
+			}
+		}
+	}
+
+	for _, check := range monitor.Answers {
+		if !found(check) {
+			return "Expected answer not found: " + check.String() + " in " + formatAnswers(records)
+		}
+	}
+
+	return ""
+}
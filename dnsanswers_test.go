@@ -0,0 +1,67 @@
+package cachet
+
+import (
+	"testing"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/miekg/dns"
+)
+
+func TestDNSMonitorAnswers(t *testing.T) {
+	server := startTestDNSServer(t, "udp", func(w dns.ResponseWriter, req *dns.Msg) {
+		m := new(dns.Msg)
+		m.SetReply(req)
+		if req.Question[0].Name != "example.test." {
+			m.Rcode = dns.RcodeNameError
+		} else {
+			for _, record := range []string{"10 mx1.example.test.", "20 mx2.example.test."} {
+				rr, _ := dns.NewRR("example.test. 300 IN MX " + record)
+				m.Answer = append(m.Answer, rr)
+			}
+		}
+		w.WriteMsg(m)
+	}, nil)
+
+	l := logrus.WithFields(logrus.Fields{})
+	tests := []struct {
+		name   string
+		mon    DNSMonitor
+		reason string
+	}{
+		{"all", DNSMonitor{Answers: []DNSAnswer{{Exact: "10 mx1.example.test."}, {Regex: "^20 "}}}, ""},
+		{"missing", DNSMonitor{Answers: []DNSAnswer{{Exact: "30 mx3.example.test."}}},
+			"Expected answer not found: exact '30 mx3.example.test.' in [10 mx1.example.test., 20 mx2.example.test.]"},
+		{"any", DNSMonitor{Match: "any", Answers: []DNSAnswer{{Exact: "30 mx3.example.test."}, {Regex: "mx2"}}}, ""},
+		{"exactly", DNSMonitor{Match: "exactly", Answers: []DNSAnswer{{Exact: "10 mx1.example.test."}}},
+			"Unexpected answer: 20 mx2.example.test. (not in the expected answers)"},
+		{"unexpected", DNSMonitor{UnexpectedAnswers: []DNSAnswer{{Regex: "mx2"}}},
+			"Unexpected answer: 20 mx2.example.test. (matches regex 'mx2')"},
+		{"count", DNSMonitor{AnswerCountMin: 3}, "Got 2 MX records, expected at least 3"},
+		{"ttl", DNSMonitor{TTLMin: 3600}, "TTL of 10 mx1.example.test. is 300, expected at least 3600"},
+		{"rcode", DNSMonitor{ExpectedRcode: "nxdomain"}, "Expected rcode NXDOMAIN, got NOERROR"},
+	}
+
+	for _, test := range tests {
+		mon := test.mon
+		mon.Name, mon.Target, mon.ComponentID, mon.Timeout = "dns", "example.test", 1, 1
+		mon.DNS, mon.Question = server, "MX"
+		if errs := mon.Validate(); len(errs) > 0 {
+			t.Fatalf("%s: unexpected validation errors: %v", test.name, errs)
+		}
+		if mon.test(l) != (len(test.reason) == 0) || mon.lastFailReason != test.reason {
+			t.Errorf("%s: unexpected fail reason: %s", test.name, mon.lastFailReason)
+		}
+	}
+
+	mon := &DNSMonitor{DNS: server, ExpectedRcode: "NXDOMAIN"}
+	mon.Name, mon.Target, mon.ComponentID, mon.Timeout = "dns", "missing.test", 1, 1
+	mon.Validate()
+	if !mon.test(l) {
+		t.Errorf("check should have passed: %s", mon.lastFailReason)
+	}
+
+	mon.Answers = []DNSAnswer{{Regex: "("}}
+	if errs := mon.Validate(); len(errs) != 1 || errs[0] != "Regexp compilation failure: error parsing regexp: missing closing ): `(`" {
+		t.Errorf("unexpected validation errors: %v", errs)
+	}
+}
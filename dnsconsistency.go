@@ -0,0 +1,220 @@
+package cachet
+
+import (
+	"errors"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/miekg/dns"
+)
+
+// dnsServer is one of the servers compared by a consistency check
+type dnsServer struct {
+	// nameserver name (discovered servers) or address
+	name     string
+	address  string
+	protocol string
+	// queried without recursion (discovered nameservers)
+	authoritative bool
+}
+
+func (s dnsServer) String() string {
+	if s.name == s.address {
+		return s.address
+	}
+
+	return s.name + " (" + s.address + ")"
+}
+
+// dnsServerResult is what a server answered
+type dnsServerResult struct {
+	server  dnsServer
+	answers []string
+	serial  uint32
+	err     error
+}
+
+// checksConsistency tells whether several servers are compared
+func (monitor *DNSMonitor) checksConsistency() bool {
+	return len(monitor.Servers) > 0 || monitor.Authoritative
+}
+
+// nameserverProtocol is used to query the discovered nameservers, which only serve plain DNS
+func (monitor *DNSMonitor) nameserverProtocol() string {
+	if monitor.Protocol == "tcp" {
+		return "tcp"
+	}
+
+	return "udp"
+}
+
+// checkConsistency queries all the servers and returns a fail reason when they disagree
+func (monitor *DNSMonitor) checkConsistency() string {
+	servers := []dnsServer{}
+	if monitor.Authoritative {
+		discovered, err := monitor.discoverNameservers()
+		if err != nil {
+			return "Could not discover the nameservers of " + monitor.Zone + ": " + err.Error()
+		}
+		servers = discovered
+	}
+	for _, address := range monitor.Servers {
+		servers = append(servers, dnsServer{address, address, monitor.Protocol, false})
+	}
+
+	results := make([]dnsServerResult, len(servers))
+	var wg sync.WaitGroup
+	for i, server := range servers {
+		wg.Add(1)
+		go func(i int, server dnsServer) {
+			defer wg.Done()
+			results[i] = monitor.queryServer(server)
+		}(i, server)
+	}
+	wg.Wait()
+
+	for _, result := range results {
+		if result.err != nil {
+			return "DNS server " + result.server.String() + ": " + result.err.Error()
+		}
+	}
+
+	reference := strings.Join(results[0].answers, ", ")
+	for _, result := range results[1:] {
+		if strings.Join(result.answers, ", ") != reference {
+			disagreement := []string{}
+			for _, r := range results {
+				disagreement = append(disagreement, r.server.String()+": ["+strings.Join(r.answers, ", ")+"]")
+			}
+			return "Servers disagree on " + dns.Fqdn(monitor.Target) + " " + monitor.Question + ":\n" + strings.Join(disagreement, "\n")
+		}
+	}
+
+	if monitor.CheckSerial {
+		// serial number arithmetic (RFC 1982), relative to the first server
+		min, max := int64(0), int64(0)
+		for _, result := range results[1:] {
+			diff := int64(int32(result.serial - results[0].serial))
+			if diff < min {
+				min = diff
+			}
+			if diff > max {
+				max = diff
+			}
+		}
+
+		if max-min > int64(monitor.SerialTolerance) {
+			serials := []string{}
+			for _, r := range results {
+				serials = append(serials, r.server.String()+": "+strconv.FormatUint(uint64(r.serial), 10))
+			}
+			return "SOA serials of " + monitor.Zone + " differ by " + strconv.FormatInt(max-min, 10) + " (tolerance " + strconv.Itoa(monitor.SerialTolerance) + "):\n" + strings.Join(serials, "\n")
+		}
+	}
+
+	return ""
+}
+
+// discoverNameservers resolves the zone's NS records (and their addresses) with the monitor's resolver
+func (monitor *DNSMonitor) discoverNameservers() ([]dnsServer, error) {
+	m := new(dns.Msg)
+	m.SetQuestion(monitor.Zone, dns.TypeNS)
+	r, err := monitor.exchange(m, monitor.Protocol, monitor.DNS)
+	if err != nil {
+		return nil, err
+	}
+	if r.Rcode != dns.RcodeSuccess {
+		return nil, errors.New("NS query returned " + dns.RcodeToString[r.Rcode])
+	}
+
+	servers := []dnsServer{}
+	for _, rr := range r.Answer {
+		ns, ok := rr.(*dns.NS)
+		if !ok {
+			continue
+		}
+
+		addresses := []string{}
+		for _, qtype := range []uint16{dns.TypeA, dns.TypeAAAA} {
+			m := new(dns.Msg)
+			m.SetQuestion(ns.Ns, qtype)
+			r, err := monitor.exchange(m, monitor.Protocol, monitor.DNS)
+			if err != nil {
+				return nil, errors.New("could not resolve " + ns.Ns + ": " + err.Error())
+			}
+			for _, rr := range r.Answer {
+				switch a := rr.(type) {
+				case *dns.A:
+					addresses = append(addresses, a.A.String())
+				case *dns.AAAA:
+					addresses = append(addresses, a.AAAA.String())
+				}
+			}
+			// one address family is enough
+			if len(addresses) > 0 {
+				break
+			}
+		}
+		if len(addresses) == 0 {
+			return nil, errors.New("no address for nameserver " + ns.Ns)
+		}
+
+		servers = append(servers, dnsServer{ns.Ns, net.JoinHostPort(addresses[0], "53"), monitor.nameserverProtocol(), true})
+	}
+
+	if len(servers) == 0 {
+		return nil, errors.New("no NS records")
+	}
+
+	return servers, nil
+}
+
+// queryServer asks a server the monitor's question (and the zone's SOA serial)
+func (monitor *DNSMonitor) queryServer(server dnsServer) dnsServerResult {
+	result := dnsServerResult{server: server}
+	protocol := server.protocol
+
+	m := new(dns.Msg)
+	m.SetQuestion(dns.Fqdn(monitor.Target), monitor.question)
+	m.RecursionDesired = !server.authoritative
+	r, err := monitor.exchange(m, protocol, server.address)
+	if err != nil {
+		result.err = err
+		return result
+	}
+	if r.Rcode != monitor.rcode {
+		result.err = errors.New("query returned " + dns.RcodeToString[r.Rcode])
+		return result
+	}
+
+	result.answers = []string{}
+	for _, rr := range r.Answer {
+		if rr.Header().Rrtype == monitor.question {
+			result.answers = append(result.answers, answerData(rr))
+		}
+	}
+	sort.Strings(result.answers)
+
+	if monitor.CheckSerial {
+		m := new(dns.Msg)
+		m.SetQuestion(monitor.Zone, dns.TypeSOA)
+		m.RecursionDesired = !server.authoritative
+		r, err := monitor.exchange(m, protocol, server.address)
+		if err != nil {
+			result.err = err
+			return result
+		}
+		for _, rr := range r.Answer {
+			if soa, ok := rr.(*dns.SOA); ok {
+				result.serial = soa.Serial
+				return result
+			}
+		}
+		result.err = errors.New("no SOA record for " + monitor.Zone)
+	}
+
+	return result
+}
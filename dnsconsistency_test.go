@@ -0,0 +1,112 @@
+package cachet
+
+import (
+	"crypto/tls"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/miekg/dns"
+)
+
+// testZoneHandler answers for the example.test. zone with the given address and SOA serial
+func testZoneHandler(address string, serial uint32) dns.HandlerFunc {
+	return func(w dns.ResponseWriter, req *dns.Msg) {
+		m := new(dns.Msg)
+		m.SetReply(req)
+		switch req.Question[0].Qtype {
+		case dns.TypeA:
+			rr, _ := dns.NewRR("www.example.test. 300 IN A " + address)
+			m.Answer = append(m.Answer, rr)
+		case dns.TypeSOA:
+			m.Answer = append(m.Answer, &dns.SOA{
+				Hdr:    dns.RR_Header{Name: "example.test.", Rrtype: dns.TypeSOA, Class: dns.ClassINET, Ttl: 300},
+				Ns:     "ns1.example.test.",
+				Mbox:   "hostmaster.example.test.",
+				Serial: serial,
+			})
+		}
+		w.WriteMsg(m)
+	}
+}
+
+func TestDNSMonitorConsistency(t *testing.T) {
+	primary := startTestDNSServer(t, "udp", testZoneHandler("192.0.2.1", 2024010102), nil)
+	secondary := startTestDNSServer(t, "udp", testZoneHandler("192.0.2.1", 2024010101), nil)
+	stale := startTestDNSServer(t, "udp", testZoneHandler("192.0.2.9", 2023120101), nil)
+
+	l := logrus.WithFields(logrus.Fields{})
+	mon := &DNSMonitor{DNS: primary, Zone: "example.test", Servers: []string{primary, secondary}, CheckSerial: true, SerialTolerance: 1}
+	mon.Name, mon.Target, mon.ComponentID, mon.Timeout = "dns", "www.example.test", 1, 1
+	if errs := mon.Validate(); len(errs) > 0 {
+		t.Fatalf("unexpected validation errors: %v", errs)
+	}
+	if !mon.test(l) {
+		t.Errorf("check should have passed: %s", mon.lastFailReason)
+	}
+
+	mon.SerialTolerance = 0
+	if mon.test(l) || mon.lastFailReason != "SOA serials of example.test. differ by 1 (tolerance 0):\n"+primary+": 2024010102\n"+secondary+": 2024010101" {
+		t.Errorf("unexpected fail reason: %s", mon.lastFailReason)
+	}
+
+	mon.Servers, mon.CheckSerial = []string{primary, stale}, false
+	if mon.test(l) || !strings.HasPrefix(mon.lastFailReason, "Servers disagree on www.example.test. A:\n"+primary+": [192.0.2.1]\n"+stale+": [192.0.2.9]") {
+		t.Errorf("unexpected fail reason: %s", mon.lastFailReason)
+	}
+
+	mon = &DNSMonitor{CheckSerial: true}
+	mon.Name, mon.Target, mon.ComponentID, mon.Timeout = "dns", "www.example.test", 1, 1
+	if errs := mon.Validate(); len(errs) != 1 || errs[0] != "'check_serial' needs 'servers' or 'authoritative'" {
+		t.Errorf("unexpected validation errors: %v", errs)
+	}
+}
+
+func TestDNSMonitorConsistencyProtocols(t *testing.T) {
+	certs := httptest.NewTLSServer(nil)
+	defer certs.Close()
+	dot := startTestDNSServer(t, "tcp-tls", testZoneHandler("192.0.2.1", 1), &tls.Config{Certificates: certs.TLS.Certificates})
+
+	mon := &DNSMonitor{DNS: dot, Protocol: "tls", Insecure: true, Zone: "example.test", Authoritative: true, Servers: []string{dot}}
+	mon.Name, mon.Target, mon.ComponentID, mon.Timeout = "dns", "www.example.test", 1, 1
+	if errs := mon.Validate(); len(errs) > 0 {
+		t.Fatalf("unexpected validation errors: %v", errs)
+	}
+
+	// listed servers keep the monitor's protocol, discovered nameservers only serve plain DNS
+	if result := mon.queryServer(dnsServer{dot, dot, mon.Protocol, false}); result.err != nil || len(result.answers) != 1 {
+		t.Errorf("listed server should have been queried over TLS: %v, %v", result.answers, result.err)
+	}
+	if protocol := mon.nameserverProtocol(); protocol != "udp" {
+		t.Errorf("discovered nameservers should be queried over udp, got %s", protocol)
+	}
+}
+
+func TestDNSMonitorConsistencyRecursion(t *testing.T) {
+	// a resolver refusing non recursive queries
+	zone := testZoneHandler("192.0.2.1", 1)
+	resolver := startTestDNSServer(t, "udp", func(w dns.ResponseWriter, req *dns.Msg) {
+		if !req.RecursionDesired {
+			m := new(dns.Msg)
+			m.SetRcode(req, dns.RcodeRefused)
+			w.WriteMsg(m)
+			return
+		}
+		zone(w, req)
+	}, nil)
+
+	mon := &DNSMonitor{DNS: resolver, Zone: "example.test", Authoritative: true, Servers: []string{resolver}}
+	mon.Name, mon.Target, mon.ComponentID, mon.Timeout = "dns", "www.example.test", 1, 1
+	if errs := mon.Validate(); len(errs) > 0 {
+		t.Fatalf("unexpected validation errors: %v", errs)
+	}
+
+	// listed servers are asked to recurse, discovered nameservers are not
+	if result := mon.queryServer(dnsServer{resolver, resolver, mon.Protocol, false}); result.err != nil {
+		t.Errorf("listed resolver should have been asked to recurse: %v", result.err)
+	}
+	if result := mon.queryServer(dnsServer{"ns1.example.test.", resolver, "udp", true}); result.err == nil || result.err.Error() != "query returned REFUSED" {
+		t.Errorf("nameserver should have been queried without recursion: %v", result.err)
+	}
+}
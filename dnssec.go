@@ -0,0 +1,249 @@
+package cachet
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// Root zone KSKs (KSK-2017, KSK-2024), used when no trust anchor is configured
+var defaultTrustAnchors = []string{
+	". IN DS 20326 8 2 E06D44B80B8F1D39A95C0B0D7C65D08458E880409BBC683457104237C7F8EC8D",
+	". IN DS 38696 8 2 683D2D0ACB8C9B712A1948B27F741219298D0A450D612C483AF444A4C0FB2B16",
+}
+
+// Maximum number of zones followed up to a trust anchor
+const dnssecMaxDepth = 16
+
+// parseTrustAnchors returns the DS records (DNSKEYs are converted) by owner name
+func parseTrustAnchors(anchors []string) (map[string][]*dns.DS, error) {
+	parsed := map[string][]*dns.DS{}
+	for _, anchor := range anchors {
+		rr, err := dns.NewRR(anchor)
+		if err != nil {
+			return nil, errors.New("invalid trust anchor: " + err.Error())
+		}
+
+		var ds *dns.DS
+		switch r := rr.(type) {
+		case *dns.DS:
+			ds = r
+		case *dns.DNSKEY:
+			ds = r.ToDS(dns.SHA256)
+		}
+		if ds == nil {
+			return nil, errors.New("trust anchor is neither a DS nor a DNSKEY record: " + anchor)
+		}
+
+		name := strings.ToLower(ds.Hdr.Name)
+		parsed[name] = append(parsed[name], ds)
+	}
+
+	return parsed, nil
+}
+
+// splitSigned returns the records of type qtype and the RRSIGs covering them
+func splitSigned(records []dns.RR, qtype uint16) ([]dns.RR, []*dns.RRSIG) {
+	rrset := []dns.RR{}
+	sigs := []*dns.RRSIG{}
+	for _, rr := range records {
+		if sig, ok := rr.(*dns.RRSIG); ok {
+			if sig.TypeCovered == qtype {
+				sigs = append(sigs, sig)
+			}
+		} else if rr.Header().Rrtype == qtype {
+			rrset = append(rrset, rr)
+		}
+	}
+
+	return rrset, sigs
+}
+
+func rrsetName(rrset []dns.RR) string {
+	return rrset[0].Header().Name + " " + dns.TypeToString[rrset[0].Header().Rrtype]
+}
+
+// rrsigExpiry converts the signature expiration (serial arithmetic) to a time
+func rrsigExpiry(sig *dns.RRSIG) time.Time {
+	now := time.Now()
+	left := int64(int32(sig.Expiration - uint32(now.Unix())))
+
+	return now.Add(time.Duration(left) * time.Second)
+}
+
+// dnssecValidation collects what was seen while validating
+type dnssecValidation struct {
+	// earliest expiration of the signatures verified
+	expiry time.Time
+}
+
+// verify checks that one of the RRSIGs of rrset is a valid signature by one of keys
+func (v *dnssecValidation) verify(rrset []dns.RR, sigs []*dns.RRSIG, keys []*dns.DNSKEY) error {
+	if len(sigs) == 0 {
+		return errors.New("no RRSIG for " + rrsetName(rrset))
+	}
+
+	var lastErr error
+	for _, sig := range sigs {
+		key := "key " + strconv.Itoa(int(sig.KeyTag))
+		for _, k := range keys {
+			if k.KeyTag() != sig.KeyTag || k.Algorithm != sig.Algorithm || !strings.EqualFold(k.Hdr.Name, sig.SignerName) {
+				continue
+			}
+
+			if !sig.ValidityPeriod(time.Now()) {
+				if rrsigExpiry(sig).Before(time.Now()) {
+					lastErr = errors.New("RRSIG of " + rrsetName(rrset) + " (" + key + ") expired on " + rrsigExpiry(sig).UTC().Format("2006-01-02 15:04 MST"))
+				} else {
+					lastErr = errors.New("RRSIG of " + rrsetName(rrset) + " (" + key + ") is not valid yet")
+				}
+				continue
+			}
+			if err := sig.Verify(k, rrset); err != nil {
+				lastErr = errors.New("bogus signature of " + rrsetName(rrset) + " (" + key + "): " + err.Error())
+				continue
+			}
+
+			if expiry := rrsigExpiry(sig); v.expiry.IsZero() || expiry.Before(v.expiry) {
+				v.expiry = expiry
+			}
+			return nil
+		}
+		if lastErr == nil {
+			lastErr = errors.New("no DNSKEY of " + sig.SignerName + " for the RRSIG of " + rrsetName(rrset) + " (" + key + ")")
+		}
+	}
+
+	return lastErr
+}
+
+// querySigned fetches an RRset and its signatures, without validation by the resolver
+func (monitor *DNSMonitor) querySigned(name string, qtype uint16) ([]dns.RR, []*dns.RRSIG, error) {
+	m := new(dns.Msg)
+	m.SetQuestion(name, qtype)
+	m.RecursionDesired = true
+	m.CheckingDisabled = true
+	m.SetEdns0(4096, true)
+
+	r, err := monitor.exchange(m, monitor.Protocol, monitor.DNS)
+	if err != nil {
+		return nil, nil, err
+	}
+	if r.Rcode != dns.RcodeSuccess {
+		return nil, nil, errors.New(name + " " + dns.TypeToString[qtype] + " query returned " + dns.RcodeToString[r.Rcode])
+	}
+
+	rrset, sigs := splitSigned(r.Answer, qtype)
+	return rrset, sigs, nil
+}
+
+// validateChain follows the chain of trust from rrset up to a trust anchor
+func (monitor *DNSMonitor) validateChain(v *dnssecValidation, rrset []dns.RR, sigs []*dns.RRSIG) error {
+	if len(sigs) == 0 {
+		return errors.New("no RRSIG for " + rrsetName(rrset) + " (unsigned zone?)")
+	}
+
+	zone := strings.ToLower(sigs[0].SignerName)
+	for depth := 0; depth < dnssecMaxDepth; depth++ {
+		records, keySigs, err := monitor.querySigned(zone, dns.TypeDNSKEY)
+		if err != nil {
+			return err
+		}
+		keys := []*dns.DNSKEY{}
+		for _, rr := range records {
+			keys = append(keys, rr.(*dns.DNSKEY))
+		}
+		if len(keys) == 0 {
+			return errors.New("no DNSKEY for " + zone)
+		}
+
+		if err := v.verify(rrset, sigs, keys); err != nil {
+			return err
+		}
+
+		// the zone's keys are trusted through the anchor or the parent's DS records
+		dsSet, anchored := monitor.trustAnchors[zone]
+		var dsRecords []dns.RR
+		var dsSigs []*dns.RRSIG
+		if !anchored {
+			if dsRecords, dsSigs, err = monitor.querySigned(zone, dns.TypeDS); err != nil {
+				return err
+			}
+			if len(dsRecords) == 0 {
+				return errors.New("no DS record for " + zone + " in its parent zone")
+			}
+			for _, rr := range dsRecords {
+				dsSet = append(dsSet, rr.(*dns.DS))
+			}
+		}
+
+		entryKeys := []*dns.DNSKEY{}
+		for _, key := range keys {
+			for _, ds := range dsSet {
+				if key.KeyTag() == ds.KeyTag && key.Algorithm == ds.Algorithm {
+					if digest := key.ToDS(ds.DigestType); digest != nil && strings.EqualFold(digest.Digest, ds.Digest) {
+						entryKeys = append(entryKeys, key)
+					}
+				}
+			}
+		}
+		if len(entryKeys) == 0 {
+			return errors.New("no DNSKEY of " + zone + " matches its DS records (bogus chain)")
+		}
+		if err := v.verify(records, keySigs, entryKeys); err != nil {
+			return err
+		}
+
+		if anchored {
+			return nil
+		}
+		if len(dsSigs) == 0 {
+			return errors.New("no RRSIG for " + zone + " DS")
+		}
+		rrset, sigs = dsRecords, dsSigs
+		zone = strings.ToLower(dsSigs[0].SignerName)
+	}
+
+	return errors.New("no trust anchor found within " + strconv.Itoa(dnssecMaxDepth) + " zones")
+}
+
+// checkDNSSEC returns the fail reason and severity when the response is not secure
+func (monitor *DNSMonitor) checkDNSSEC(r *dns.Msg) (string, int) {
+	if monitor.DNSSEC == "ad" && !r.AuthenticatedData {
+		return "DNSSEC: response for " + dns.Fqdn(monitor.Target) + " " + monitor.Question + " is not authenticated (AD flag not set)", 0
+	}
+
+	rrset, sigs := splitSigned(r.Answer, monitor.question)
+	if len(rrset) == 0 {
+		if monitor.DNSSEC == "validate" {
+			// denials of existence (NSEC/NSEC3) are not validated
+			return "DNSSEC: no signed answer to validate for " + dns.Fqdn(monitor.Target) + " " + monitor.Question, 0
+		}
+		return "", 0
+	}
+
+	v := &dnssecValidation{}
+	if monitor.DNSSEC == "validate" {
+		if err := monitor.validateChain(v, rrset, sigs); err != nil {
+			return "DNSSEC: " + err.Error(), 0
+		}
+	} else {
+		for _, sig := range sigs {
+			if expiry := rrsigExpiry(sig); v.expiry.IsZero() || expiry.Before(v.expiry) {
+				v.expiry = expiry
+			}
+		}
+	}
+
+	if monitor.SignatureExpiryWarning > 0 && !v.expiry.IsZero() {
+		left := time.Until(v.expiry)
+		if left < time.Duration(monitor.SignatureExpiryWarning)*24*time.Hour {
+			return "DNSSEC: an RRSIG expires in " + strconv.Itoa(int(left.Hours()/24+0.5)) + " days (" + v.expiry.UTC().Format("2006-01-02 15:04 MST") + ")", 3
+		}
+	}
+
+	return "", 0
+}
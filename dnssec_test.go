@@ -0,0 +1,147 @@
+package cachet
+
+import (
+	"crypto"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/miekg/dns"
+)
+
+type testSignedZone struct {
+	name     string
+	ksk, zsk *dns.DNSKEY
+	kskPriv  crypto.Signer
+	zskPriv  crypto.Signer
+}
+
+func newTestSignedZone(t *testing.T, name string) *testSignedZone {
+	z := &testSignedZone{name: name}
+	newKey := func(flags uint16) (*dns.DNSKEY, crypto.Signer) {
+		key := &dns.DNSKEY{
+			Hdr:       dns.RR_Header{Name: name, Rrtype: dns.TypeDNSKEY, Class: dns.ClassINET, Ttl: 3600},
+			Flags:     flags,
+			Protocol:  3,
+			Algorithm: dns.ECDSAP256SHA256,
+		}
+		priv, err := key.Generate(256)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return key, priv.(crypto.Signer)
+	}
+	z.ksk, z.kskPriv = newKey(257)
+	z.zsk, z.zskPriv = newKey(256)
+
+	return z
+}
+
+// sign returns rrset followed by its RRSIG, valid until expiration
+func (z *testSignedZone) sign(t *testing.T, rrset []dns.RR, ksk bool, expiration time.Time) []dns.RR {
+	key, priv := z.zsk, z.zskPriv
+	if ksk {
+		key, priv = z.ksk, z.kskPriv
+	}
+	sig := &dns.RRSIG{
+		KeyTag:     key.KeyTag(),
+		SignerName: z.name,
+		Algorithm:  key.Algorithm,
+		Inception:  uint32(time.Now().Add(-48 * time.Hour).Unix()),
+		Expiration: uint32(expiration.Unix()),
+	}
+	if err := sig.Sign(priv, rrset); err != nil {
+		t.Fatal(err)
+	}
+
+	return append(rrset, sig)
+}
+
+func TestDNSMonitorDNSSEC(t *testing.T) {
+	parent := newTestSignedZone(t, "test.")
+	zone := newTestSignedZone(t, "example.test.")
+	valid := time.Now().Add(60 * 24 * time.Hour)
+	a, _ := dns.NewRR("www.example.test. 300 IN A 192.0.2.1")
+
+	var mu sync.Mutex
+	records := map[string][]dns.RR{}
+	authenticated := false
+	build := func(aExpiration time.Time, withDS bool) {
+		mu.Lock()
+		defer mu.Unlock()
+		records = map[string][]dns.RR{
+			"test. DNSKEY":         parent.sign(t, []dns.RR{parent.ksk, parent.zsk}, true, valid),
+			"example.test. DNSKEY": zone.sign(t, []dns.RR{zone.ksk, zone.zsk}, true, valid),
+			"www.example.test. A":  zone.sign(t, []dns.RR{dns.Copy(a)}, false, aExpiration),
+		}
+		if withDS {
+			records["example.test. DS"] = parent.sign(t, []dns.RR{zone.ksk.ToDS(dns.SHA256)}, false, valid)
+		}
+	}
+	server := startTestDNSServer(t, "udp", func(w dns.ResponseWriter, req *dns.Msg) {
+		mu.Lock()
+		defer mu.Unlock()
+		m := new(dns.Msg)
+		m.SetReply(req)
+		m.AuthenticatedData = authenticated
+		m.Answer = records[req.Question[0].Name+" "+dns.TypeToString[req.Question[0].Qtype]]
+		w.WriteMsg(m)
+	}, nil)
+
+	l := logrus.WithFields(logrus.Fields{})
+	mon := &DNSMonitor{DNS: server, DNSSEC: "validate", TrustAnchors: []string{parent.ksk.ToDS(dns.SHA256).String()}}
+	mon.Name, mon.Target, mon.ComponentID, mon.Timeout = "dns", "www.example.test", 1, 1
+	if errs := mon.Validate(); len(errs) > 0 {
+		t.Fatalf("unexpected validation errors: %v", errs)
+	}
+
+	build(valid, true)
+	if !mon.test(l) {
+		t.Errorf("check should have passed: %s", mon.lastFailReason)
+	}
+
+	// expiring soon: partial outage
+	build(time.Now().Add(10*24*time.Hour), true)
+	mon.SignatureExpiryWarning = 30
+	if mon.test(l) || !strings.HasPrefix(mon.lastFailReason, "DNSSEC: an RRSIG expires in 10 days") || mon.severity != 3 {
+		t.Errorf("unexpected fail reason: %s (severity %d)", mon.lastFailReason, mon.severity)
+	}
+
+	build(time.Now().Add(-time.Hour), true)
+	mon.severity = 0
+	expected := "DNSSEC: RRSIG of www.example.test. A (key " + strconv.Itoa(int(zone.zsk.KeyTag())) + ") expired on "
+	if mon.test(l) || !strings.HasPrefix(mon.lastFailReason, expected) || mon.severity != 0 {
+		t.Errorf("unexpected fail reason: %s (severity %d)", mon.lastFailReason, mon.severity)
+	}
+
+	build(valid, false)
+	if mon.test(l) || mon.lastFailReason != "DNSSEC: no DS record for example.test. in its parent zone" {
+		t.Errorf("unexpected fail reason: %s", mon.lastFailReason)
+	}
+
+	// NODATA: nothing to validate
+	build(valid, true)
+	mu.Lock()
+	delete(records, "www.example.test. A")
+	mu.Unlock()
+	if mon.test(l) || mon.lastFailReason != "DNSSEC: no signed answer to validate for www.example.test. A" {
+		t.Errorf("unexpected fail reason: %s", mon.lastFailReason)
+	}
+	build(valid, true)
+
+	// validating resolver
+	mon.DNSSEC, mon.SignatureExpiryWarning = "ad", 0
+	mon.Validate()
+	if mon.test(l) || mon.lastFailReason != "DNSSEC: response for www.example.test. A is not authenticated (AD flag not set)" {
+		t.Errorf("unexpected fail reason: %s", mon.lastFailReason)
+	}
+	mu.Lock()
+	authenticated = true
+	mu.Unlock()
+	if !mon.test(l) {
+		t.Errorf("check should have passed: %s", mon.lastFailReason)
+	}
+}
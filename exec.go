@@ -0,0 +1,195 @@
+package cachet
+
+import (
+	"bytes"
+	"context"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+)
+
+// Nagios plugins exit codes
+const (
+	execOK       = 0
+	execWarning  = 1
+	execCritical = 2
+)
+
+// ExecMonitor runs a Nagios compatible check command
+type ExecMonitor struct {
+	AbstractMonitor `mapstructure:",squash"`
+
+	// Run through /bin/sh -c
+	Command string
+	// Perfdata label => Cachet metric IDs
+	PerfdataMetrics map[string][]int `mapstructure:"perfdata_metrics"`
+}
+
+// Perfdata is a single 'label'=value[UOM];[warn];[crit];[min];[max] item
+type Perfdata struct {
+	Label string
+	Value float64
+	UOM   string
+}
+
+func (monitor *ExecMonitor) test(l *logrus.Entry) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), monitor.Timeout*time.Second)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "/bin/sh", "-c", monitor.Command)
+	// don't wait for children keeping the output open
+	cmd.WaitDelay = time.Second
+
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+	err := cmd.Run()
+
+	summary, perfdata := parsePluginOutput(stdout.String())
+	monitor.sendPerfdata(l, perfdata)
+
+	code := execOK
+	if ctx.Err() == context.DeadlineExceeded {
+		monitor.lastFailReason = "Command timed out after " + strconv.Itoa(int(monitor.Timeout)) + "s"
+		l.Infof("%s", monitor.lastFailReason)
+		return false
+	} else if exitErr, ok := err.(*exec.ExitError); ok {
+		code = exitErr.ExitCode()
+	} else if err != nil {
+		monitor.lastFailReason = "Command failed: " + err.Error()
+		l.Infof("%s", monitor.lastFailReason)
+		return false
+	}
+
+	if len(summary) == 0 {
+		summary = "Command exited with code " + strconv.Itoa(code)
+	}
+
+	switch code {
+	case execOK:
+		monitor.triggerShellHook(l, "on_success", monitor.ShellHookOnSuccess, summary)
+		return true
+	case execWarning:
+		monitor.severity = 3
+	case execCritical:
+		monitor.severity = 4
+	default:
+		// unknown (3) or unexpected code: nothing is recorded
+		monitor.unknown = true
+	}
+
+	monitor.lastFailReason = summary
+	l.Infof("Command exited with code %d: %s", code, summary)
+
+	return false
+}
+
+func (monitor *ExecMonitor) sendPerfdata(l *logrus.Entry, perfdata []Perfdata) {
+	if monitor.config == nil {
+		return
+	}
+	if writer, _ := monitor.config.isWriter(); !writer {
+		return
+	}
+
+	for _, p := range perfdata {
+		if ids, ok := monitor.PerfdataMetrics[p.Label]; ok {
+			go monitor.config.API.SendMetrics(l, p.Label, ids, p.Value)
+		}
+	}
+}
+
+// parsePluginOutput returns the first line of the output (without perfdata) and all the perfdata
+func parsePluginOutput(output string) (string, []Perfdata) {
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+
+	summary := lines[0]
+	raw := ""
+	if i := strings.Index(summary, "|"); i >= 0 {
+		raw = summary[i+1:]
+		summary = summary[:i]
+	}
+
+	// long output may carry more perfdata after a '|'
+	for _, line := range lines[1:] {
+		if i := strings.Index(line, "|"); i >= 0 {
+			raw += " " + line[i+1:]
+		}
+	}
+
+	return strings.TrimSpace(summary), parsePerfdata(raw)
+}
+
+func parsePerfdata(raw string) []Perfdata {
+	perfdata := []Perfdata{}
+
+	for len(strings.TrimSpace(raw)) > 0 {
+		raw = strings.TrimSpace(raw)
+
+		// labels can be quoted to contain spaces
+		var label string
+		if strings.HasPrefix(raw, "'") {
+			end := strings.Index(raw[1:], "'=")
+			if end < 0 {
+				break
+			}
+			label = raw[1 : end+1]
+			raw = raw[end+2:]
+		} else {
+			end := strings.Index(raw, "=")
+			if end < 0 {
+				break
+			}
+			label = raw[:end]
+			raw = raw[end:]
+		}
+		raw = strings.TrimPrefix(raw, "=")
+
+		item := raw
+		if end := strings.IndexAny(raw, " \t"); end >= 0 {
+			item = raw[:end]
+			raw = raw[end:]
+		} else {
+			raw = ""
+		}
+
+		value := strings.SplitN(item, ";", 2)[0]
+		number := strings.TrimRightFunc(value, func(r rune) bool {
+			return !strings.ContainsRune("0123456789.-", r)
+		})
+
+		v, err := strconv.ParseFloat(number, 64)
+		if err != nil {
+			continue
+		}
+
+		perfdata = append(perfdata, Perfdata{Label: label, Value: v, UOM: value[len(number):]})
+	}
+
+	return perfdata
+}
+
+func (mon *ExecMonitor) Validate() []string {
+	mon.Template.Investigating.SetDefault(defaultHTTPInvestigatingTpl)
+	mon.Template.Fixed.SetDefault(defaultHTTPFixedTpl)
+
+	errs := mon.AbstractMonitor.Validate()
+
+	if len(mon.Command) == 0 {
+		errs = append(errs, "'command' has not been set")
+	}
+
+	return errs
+}
+
+func (mon *ExecMonitor) Describe() []string {
+	features := mon.AbstractMonitor.Describe()
+	features = append(features, "Command: "+mon.Command)
+	if len(mon.PerfdataMetrics) > 0 {
+		features = append(features, "Perfdata metrics: "+strconv.Itoa(len(mon.PerfdataMetrics)))
+	}
+
+	return features
+}
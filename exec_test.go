@@ -0,0 +1,54 @@
+package cachet
+
+import (
+	"testing"
+
+	"github.com/Sirupsen/logrus"
+)
+
+func TestParsePluginOutput(t *testing.T) {
+	summary, perfdata := parsePluginOutput("DISK OK - free space: / 3326 MB (56%); | /=2643MB;5948;5958;0;5968 'time taken'=0.012s\nlong output | load1=0.5;;;0\n")
+
+	if summary != "DISK OK - free space: / 3326 MB (56%);" {
+		t.Errorf("unexpected summary: %s", summary)
+	}
+
+	expected := []Perfdata{{"/", 2643, "MB"}, {"time taken", 0.012, "s"}, {"load1", 0.5, ""}}
+	if len(perfdata) != len(expected) {
+		t.Fatalf("unexpected perfdata: %v", perfdata)
+	}
+	for i, p := range expected {
+		if perfdata[i] != p {
+			t.Errorf("expected %v, got %v", p, perfdata[i])
+		}
+	}
+}
+
+func TestExecMonitorExitCodes(t *testing.T) {
+	l := logrus.WithFields(logrus.Fields{})
+
+	for _, tc := range []struct {
+		command  string
+		up       bool
+		severity int
+		unknown  bool
+	}{
+		{"echo OK; exit 0", true, 0, false},
+		{"echo 'WARNING - slow'; exit 1", false, 3, false},
+		{"echo 'CRITICAL - down'; exit 2", false, 4, false},
+		{"echo 'UNKNOWN - no idea'; exit 3", false, 0, true},
+	} {
+		mon := &ExecMonitor{Command: tc.command}
+		mon.Timeout = 5
+
+		if up := mon.test(l); up != tc.up || mon.severity != tc.severity || mon.unknown != tc.unknown {
+			t.Errorf("%s: got up=%t severity=%d unknown=%t", tc.command, up, mon.severity, mon.unknown)
+		}
+	}
+
+	mon := &ExecMonitor{Command: "sleep 5"}
+	mon.Timeout = 1
+	if mon.test(l) || mon.lastFailReason != "Command timed out after 1s" {
+		t.Errorf("command should have timed out: %s", mon.lastFailReason)
+	}
+}
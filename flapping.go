@@ -0,0 +1,78 @@
+package cachet
+
+import (
+	"github.com/Sirupsen/logrus"
+)
+
+// Unstable (flapping) template
+var defaultUnstableTpl = MessageTemplate{
+	Subject: `{{ .Monitor.Name }} is unstable - {{ .SystemName }}`,
+	Message: `{{ .Monitor.Name }} check is **flapping** (server time: {{ .now }})
+
+State change rate: {{ printf "%.0f" .FlapRate }}%
+
+{{ .FailReason }}`,
+}
+
+// stateChangeRate returns the percentage of up/down transitions in the history
+func (mon *AbstractMonitor) stateChangeRate() float32 {
+	if len(mon.history) < 2 {
+		return 0
+	}
+
+	changes := 0
+	for i := 1; i < len(mon.history); i++ {
+		if mon.history[i] != mon.history[i-1] {
+			changes++
+		}
+	}
+
+	return float32(changes) / float32(len(mon.history)-1) * 100
+}
+
+// analyseFlapping pins a flapping monitor to partial outage with a single "unstable" incident.
+// Returns true while flapping, meaning the regular analysis has to be skipped.
+func (mon *AbstractMonitor) analyseFlapping(l *logrus.Entry) bool {
+	if mon.FlapThreshold == 0 {
+		return false
+	}
+
+	rate := mon.stateChangeRate()
+
+	if mon.flapping {
+		if int(rate) > mon.FlapThresholdLow {
+			l.Debugf("monitor still flapping (state change rate=%.2f%%, low threshold=%d%%)", rate, mon.FlapThresholdLow)
+			// counted like a triggered analysis
+			go mon.config.API.SendMetrics(l, "incident count", mon.Metrics.IncidentCount, 1)
+			if !mon.isPartial() {
+				mon.config.API.SetComponentStatus(mon, 3)
+			}
+			return true
+		}
+
+		l.Infof("monitor settled (state change rate=%.2f%%, low threshold=%d%%)", rate, mon.FlapThresholdLow)
+		mon.flapping = false
+		return false
+	}
+
+	if int(rate) < mon.FlapThreshold {
+		return false
+	}
+
+	l.Warnf("monitor is flapping (state change rate=%.2f%%, threshold=%d%%)", rate, mon.FlapThreshold)
+	mon.flapping = true
+	go mon.config.API.SendMetrics(l, "incident count", mon.Metrics.IncidentCount, 1)
+
+	if mon.incident == nil {
+		tplData := getTemplateData(mon)
+		tplData["FlapRate"] = rate
+
+		mon.openIncident(l, &mon.Template.Unstable, tplData, 3)
+	}
+
+	if !mon.isPartial() {
+		mon.config.API.SetComponentStatus(mon, 3)
+	}
+
+	return true
+}
@@ -0,0 +1,148 @@
+package cachet
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io/ioutil"
+	"strconv"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+)
+
+// GRPCMonitor calls the standard grpc.health.v1.Health/Check RPC
+type GRPCMonitor struct {
+	AbstractMonitor `mapstructure:",squash"`
+
+	// Service name sent in the request (blank: the server's overall health)
+	Service string
+	// Plaintext unless set (certificate verified when strict)
+	TLS bool
+	// PEM files: CA verifying the server (system pool by default), client certificate for mTLS
+	CACert     string `mapstructure:"ca_cert"`
+	ClientCert string `mapstructure:"client_cert"`
+	ClientKey  string `mapstructure:"client_key"`
+	// Name expected in the server certificate (defaults to the target's host)
+	ServerName string `mapstructure:"server_name"`
+	// Sent as request metadata (e.g. authorization)
+	Metadata map[string]string
+
+	tlsConfig *tls.Config
+}
+
+func (monitor *GRPCMonitor) test(l *logrus.Entry) bool {
+	creds := insecure.NewCredentials()
+	if monitor.tlsConfig != nil {
+		creds = credentials.NewTLS(monitor.tlsConfig)
+	}
+
+	conn, err := grpc.NewClient(monitor.Target, grpc.WithTransportCredentials(creds), grpc.WithUserAgent("Cachet-Monitor"))
+	if err != nil {
+		monitor.lastFailReason = err.Error()
+		l.Infof("gRPC error: %s", monitor.lastFailReason)
+		return false
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), monitor.Timeout*time.Second)
+	defer cancel()
+	if len(monitor.Metadata) > 0 {
+		ctx = metadata.NewOutgoingContext(ctx, metadata.New(monitor.Metadata))
+	}
+
+	resp, err := grpc_health_v1.NewHealthClient(conn).Check(ctx, &grpc_health_v1.HealthCheckRequest{Service: monitor.Service})
+	if err != nil {
+		monitor.lastFailReason = err.Error()
+		l.Infof("gRPC error: %s", monitor.lastFailReason)
+		return false
+	}
+
+	if resp.Status != grpc_health_v1.HealthCheckResponse_SERVING {
+		monitor.lastFailReason = "Health status: " + resp.Status.String()
+		if len(monitor.Service) > 0 {
+			monitor.lastFailReason = "Service '" + monitor.Service + "' health status: " + resp.Status.String()
+		}
+		l.Infof("%s", monitor.lastFailReason)
+		return false
+	}
+
+	monitor.triggerShellHook(l, "on_success", monitor.ShellHookOnSuccess, resp.Status.String())
+
+	return true
+}
+
+func (monitor *GRPCMonitor) loadTLSConfig() (*tls.Config, error) {
+	config := &tls.Config{
+		ServerName:         monitor.ServerName,
+		InsecureSkipVerify: !monitor.Strict,
+	}
+
+	if len(monitor.CACert) > 0 {
+		pem, err := ioutil.ReadFile(monitor.CACert)
+		if err != nil {
+			return nil, err
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, errors.New("no certificate found in " + monitor.CACert)
+		}
+	}
+
+	if len(monitor.ClientCert) > 0 || len(monitor.ClientKey) > 0 {
+		cert, err := tls.LoadX509KeyPair(monitor.ClientCert, monitor.ClientKey)
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	return config, nil
+}
+
+func (mon *GRPCMonitor) Validate() []string {
+	mon.Template.Investigating.SetDefault(defaultHTTPInvestigatingTpl)
+	mon.Template.Fixed.SetDefault(defaultHTTPFixedTpl)
+
+	errs := mon.AbstractMonitor.Validate()
+
+	if len(mon.Target) == 0 {
+		errs = append(errs, "'Target' has not been set")
+	}
+
+	mon.tlsConfig = nil
+	if mon.TLS {
+		config, err := mon.loadTLSConfig()
+		if err != nil {
+			errs = append(errs, "TLS configuration: "+err.Error())
+		}
+		mon.tlsConfig = config
+	} else if len(mon.CACert) > 0 || len(mon.ClientCert) > 0 {
+		errs = append(errs, "Certificates are set but 'tls' is not")
+	}
+
+	return errs
+}
+
+func (mon *GRPCMonitor) Describe() []string {
+	features := mon.AbstractMonitor.Describe()
+	if len(mon.Service) > 0 {
+		features = append(features, "Service: "+mon.Service)
+	}
+	features = append(features, "TLS: "+strconv.FormatBool(mon.TLS))
+	if mon.TLS {
+		features = append(features, "Insecure: "+strconv.FormatBool(!mon.Strict))
+		features = append(features, "Client certificate: "+strconv.FormatBool(len(mon.ClientCert) > 0))
+	}
+	if len(mon.Metadata) > 0 {
+		features = append(features, "Metadata headers: "+strconv.Itoa(len(mon.Metadata)))
+	}
+
+	return features
+}
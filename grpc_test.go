@@ -0,0 +1,63 @@
+package cachet
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/Sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestGRPCMonitor(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// rejects calls without the expected token
+	auth := func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if md, _ := metadata.FromIncomingContext(ctx); len(md.Get("authorization")) == 0 || md.Get("authorization")[0] != "Bearer s3cr3t" {
+			return nil, status.Error(codes.Unauthenticated, "missing token")
+		}
+		return handler(ctx, req)
+	}
+
+	server := grpc.NewServer(grpc.UnaryInterceptor(auth))
+	healthServer := health.NewServer()
+	grpc_health_v1.RegisterHealthServer(server, healthServer)
+	go server.Serve(ln)
+	defer server.Stop()
+
+	l := logrus.WithFields(logrus.Fields{})
+	mon := &GRPCMonitor{Service: "billing", Metadata: map[string]string{"authorization": "Bearer s3cr3t"}}
+	mon.Name, mon.Target, mon.ComponentID, mon.Timeout = "grpc", ln.Addr().String(), 1, 2
+	if errs := mon.Validate(); len(errs) > 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+
+	healthServer.SetServingStatus("billing", grpc_health_v1.HealthCheckResponse_SERVING)
+	if !mon.test(l) {
+		t.Errorf("check should have passed: %s", mon.lastFailReason)
+	}
+
+	healthServer.SetServingStatus("billing", grpc_health_v1.HealthCheckResponse_NOT_SERVING)
+	if mon.test(l) || mon.lastFailReason != "Service 'billing' health status: NOT_SERVING" {
+		t.Errorf("unexpected fail reason: %s", mon.lastFailReason)
+	}
+
+	mon.Service = "unknown"
+	if mon.test(l) || mon.lastFailReason != "rpc error: code = NotFound desc = unknown service" {
+		t.Errorf("unexpected fail reason: %s", mon.lastFailReason)
+	}
+
+	mon.Metadata = nil
+	if mon.test(l) || mon.lastFailReason != "rpc error: code = Unauthenticated desc = missing token" {
+		t.Errorf("unexpected fail reason: %s", mon.lastFailReason)
+	}
+}
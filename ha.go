@@ -0,0 +1,180 @@
+package cachet
+
+import (
+	"encoding/json"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+)
+
+// DefaultLease in seconds
+const DefaultLease = 15
+const haLeaderKey = "leader"
+
+// HAConfig elects a single writer among replicas: all of them probe but only
+// the leader writes to Cachet
+type HAConfig struct {
+	Store StoreConfig `json:"store" yaml:"store"`
+	// Seconds the leadership is kept without renewal (renewed every third of it)
+	Lease time.Duration `json:"lease" yaml:"lease"`
+	// Replica identity, defaults to <system_name>/<hostname>/<pid>
+	ID string `json:"id" yaml:"id"`
+
+	store Store
+	stopC chan bool
+
+	mu     sync.Mutex
+	leader bool
+	// expiry of the lease held by this replica
+	expires time.Time
+	// incremented each time the leadership is acquired
+	term int
+}
+
+// lease is the value held under haLeaderKey
+type lease struct {
+	Holder  string `json:"holder"`
+	Expires int64  `json:"expires"`
+}
+
+func (ha *HAConfig) Validate(systemName string) []string {
+	errs := []string{}
+
+	if ha.Lease < 1 {
+		ha.Lease = DefaultLease
+	}
+
+	if len(ha.ID) == 0 {
+		ha.ID = systemName + "/" + getHostname() + "/" + strconv.Itoa(os.Getpid())
+	}
+
+	store, err := ha.Store.Open()
+	if err != nil {
+		errs = append(errs, "HA: "+err.Error())
+	}
+	ha.store = store
+
+	return errs
+}
+
+// Start runs the election until Stop is called
+func (ha *HAConfig) Start() {
+	ha.stopC = make(chan bool)
+
+	ha.elect()
+
+	go func() {
+		ticker := time.NewTicker(ha.Lease * time.Second / 3)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				ha.elect()
+			case <-ha.stopC:
+				return
+			}
+		}
+	}()
+}
+
+// Stop ends the election and releases the lease so that another replica takes over right away
+func (ha *HAConfig) Stop() {
+	if ha.stopC == nil {
+		return
+	}
+	close(ha.stopC)
+
+	ha.mu.Lock()
+	defer ha.mu.Unlock()
+
+	if !ha.leader {
+		return
+	}
+	ha.leader = false
+
+	current, err := ha.store.Get(haLeaderKey)
+	if err != nil || current == nil {
+		return
+	}
+	released, _ := json.Marshal(lease{Holder: ha.ID, Expires: 0})
+	if _, err := ha.store.CompareAndSwap(haLeaderKey, current, released); err != nil {
+		logrus.Warnf("Could not release leadership: %v", err)
+	}
+}
+
+// elect renews the lease when held, or takes it over once expired
+func (ha *HAConfig) elect() {
+	leader, expires, err := ha.acquire()
+	if err != nil {
+		// without the store we cannot tell: step down to avoid double writes
+		logrus.Warnf("Leader election failed: %v", err)
+		leader = false
+	}
+
+	ha.mu.Lock()
+	defer ha.mu.Unlock()
+
+	if leader && !ha.leader {
+		ha.term++
+		logrus.Infof("This replica (%s) is now the leader", ha.ID)
+	} else if !leader && ha.leader {
+		logrus.Warnf("This replica (%s) lost the leadership", ha.ID)
+	}
+	ha.leader = leader
+	ha.expires = expires
+}
+
+// acquire returns whether the lease is held by this replica, and until when
+func (ha *HAConfig) acquire() (bool, time.Time, error) {
+	current, err := ha.store.Get(haLeaderKey)
+	if err != nil {
+		return false, time.Time{}, err
+	}
+
+	if current != nil {
+		var l lease
+		if err := json.Unmarshal(current, &l); err == nil && l.Holder != ha.ID && time.Now().UnixNano() < l.Expires {
+			// held by another replica
+			return false, time.Time{}, nil
+		}
+	}
+
+	expires := time.Now().Add(ha.Lease * time.Second)
+	next, _ := json.Marshal(lease{Holder: ha.ID, Expires: expires.UnixNano()})
+
+	swapped, err := ha.store.CompareAndSwap(haLeaderKey, current, next)
+	if !swapped {
+		return false, time.Time{}, err
+	}
+
+	return true, expires, err
+}
+
+// IsLeader returns the leadership state and the current term.
+// A lease which could not be renewed in time is not trusted: another replica
+// may take it over once expired.
+func (ha *HAConfig) IsLeader() (bool, int) {
+	ha.mu.Lock()
+	defer ha.mu.Unlock()
+
+	// safety margin for clock drift and slow writes
+	margin := ha.Lease * time.Second / 6
+	if ha.leader && !time.Now().Before(ha.expires.Add(-margin)) {
+		return false, ha.term
+	}
+
+	return ha.leader, ha.term
+}
+
+// isWriter tells if this instance may write to Cachet (always true without HA)
+func (cfg *CachetMonitor) isWriter() (bool, int) {
+	if cfg.HA == nil {
+		return true, 0
+	}
+
+	return cfg.HA.IsLeader()
+}
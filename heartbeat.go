@@ -0,0 +1,147 @@
+package cachet
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+)
+
+const heartbeatPrefix = "/heartbeat/"
+
+// HeartbeatMonitor doesn't probe anything: jobs ping the daemon
+// (/heartbeat/<name>?token=...) and the check fails when no ping arrived in time
+type HeartbeatMonitor struct {
+	AbstractMonitor `mapstructure:",squash"`
+
+	// Expected as ?token= or "Authorization: Bearer <token>"
+	Token string
+	// Seconds tolerated on top of the interval
+	Grace time.Duration
+
+	mu          sync.Mutex
+	lastPing    time.Time
+	lastFailed  bool
+	lastMessage string
+}
+
+func (monitor *HeartbeatMonitor) test(l *logrus.Entry) bool {
+	monitor.mu.Lock()
+	lastPing, failed, message := monitor.lastPing, monitor.lastFailed, monitor.lastMessage
+	monitor.mu.Unlock()
+
+	deadline := lastPing.Add((monitor.Interval + monitor.Grace) * time.Second)
+	if time.Now().After(deadline) {
+		monitor.lastFailReason = "No heartbeat received since " + lastPing.Format(monitor.config.DateFormat)
+		l.Infof("%s", monitor.lastFailReason)
+		return false
+	}
+
+	if failed {
+		monitor.lastFailReason = "Job reported a failure"
+		if len(message) > 0 {
+			monitor.lastFailReason += ": " + message
+		}
+		l.Infof("%s", monitor.lastFailReason)
+		return false
+	}
+
+	monitor.triggerShellHook(l, "on_success", monitor.ShellHookOnSuccess, message)
+
+	return true
+}
+
+// ping records a heartbeat
+func (monitor *HeartbeatMonitor) ping(failed bool, message string) {
+	monitor.mu.Lock()
+	defer monitor.mu.Unlock()
+
+	monitor.lastPing = time.Now()
+	monitor.lastFailed = failed
+	monitor.lastMessage = message
+}
+
+func (mon *HeartbeatMonitor) Init(cfg *CachetMonitor) bool {
+	// jobs get a full interval to send their first ping
+	mon.ping(false, "")
+
+	return mon.AbstractMonitor.Init(cfg)
+}
+
+func (mon *HeartbeatMonitor) Validate() []string {
+	mon.Template.Investigating.SetDefault(defaultHTTPInvestigatingTpl)
+	mon.Template.Fixed.SetDefault(defaultHTTPFixedTpl)
+
+	errs := mon.AbstractMonitor.Validate()
+
+	if strings.Contains(mon.Name, "/") {
+		errs = append(errs, "Heartbeat monitor name cannot contain '/'")
+	}
+
+	if mon.Grace < 0 {
+		mon.Grace = 0
+	}
+
+	return errs
+}
+
+func (mon *HeartbeatMonitor) Describe() []string {
+	features := mon.AbstractMonitor.Describe()
+	features = append(features, "Endpoint: "+heartbeatPrefix+url.PathEscape(mon.Name))
+	features = append(features, "Token required: "+strconv.FormatBool(len(mon.Token) > 0))
+
+	return features
+}
+
+// heartbeatHandler serves /heartbeat/<name> (and /heartbeat/<name>/fail)
+func (cfg *CachetMonitor) heartbeatHandler(w http.ResponseWriter, r *http.Request) {
+	path, err := url.PathUnescape(strings.TrimPrefix(r.URL.EscapedPath(), heartbeatPrefix))
+	if err != nil {
+		http.Error(w, "invalid monitor name", http.StatusBadRequest)
+		return
+	}
+
+	name := strings.TrimSuffix(path, "/fail")
+	failed := name != path || r.URL.Query().Get("status") == "fail"
+
+	var monitor *HeartbeatMonitor
+	for _, m := range cfg.Monitors {
+		if hb, ok := m.(*HeartbeatMonitor); ok && hb.Name == name {
+			monitor = hb
+			break
+		}
+	}
+	if monitor == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	if len(monitor.Token) > 0 {
+		token := r.URL.Query().Get("token")
+		if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+			token = strings.TrimPrefix(auth, "Bearer ")
+		}
+		if subtle.ConstantTimeCompare([]byte(token), []byte(monitor.Token)) != 1 {
+			http.Error(w, "invalid token", http.StatusForbidden)
+			return
+		}
+	}
+
+	monitor.ping(failed, r.URL.Query().Get("msg"))
+	logrus.WithFields(logrus.Fields{"monitor": monitor.Name}).Debugf("Heartbeat received (failed: %t)", failed)
+
+	w.Write([]byte("OK\n"))
+}
+
+// Handler returns the HTTP endpoints of the daemon
+func (cfg *CachetMonitor) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc(heartbeatPrefix, cfg.heartbeatHandler)
+
+	return mux
+}
@@ -0,0 +1,63 @@
+package cachet
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+)
+
+func TestHeartbeat(t *testing.T) {
+	mon := &HeartbeatMonitor{Token: "secret"}
+	mon.Name = "nightly backup"
+	mon.Interval = 60
+	cfg := &CachetMonitor{DateFormat: DefaultTimeFormat, Monitors: []MonitorInterface{mon}}
+	mon.config = cfg
+
+	l := logrus.WithFields(logrus.Fields{})
+	mon.lastPing = time.Now().Add(-2 * time.Minute)
+	if mon.test(l) {
+		t.Error("check should fail when no ping arrived within the interval")
+	}
+
+	for _, tc := range []struct {
+		url  string
+		code int
+	}{
+		{"/heartbeat/unknown?token=secret", 404},
+		{"/heartbeat/nightly%20backup?token=wrong", 403},
+		{"/heartbeat/nightly%20backup?token=secret", 200},
+	} {
+		w := httptest.NewRecorder()
+		cfg.Handler().ServeHTTP(w, httptest.NewRequest("GET", tc.url, nil))
+		if w.Code != tc.code {
+			t.Errorf("%s: expected status %d, got %d", tc.url, tc.code, w.Code)
+		}
+	}
+	if !mon.test(l) {
+		t.Errorf("check should succeed after a ping: %s", mon.lastFailReason)
+	}
+
+	w := httptest.NewRecorder()
+	cfg.Handler().ServeHTTP(w, httptest.NewRequest("POST", "/heartbeat/nightly%20backup/fail?token=secret&msg=disk+full", nil))
+	if mon.test(l) || mon.lastFailReason != "Job reported a failure: disk full" {
+		t.Errorf("reported failure not recorded: %s", mon.lastFailReason)
+	}
+}
+
+func TestHeartbeatValidate(t *testing.T) {
+	mon := &HeartbeatMonitor{}
+	mon.Name, mon.ComponentID, mon.Interval, mon.Timeout = "nightly backup", 1, 86400, 1
+	if errs := mon.Validate(); len(errs) > 0 {
+		t.Fatalf("unexpected validation errors: %v", errs)
+	}
+	if mon.Template.Investigating.Subject != defaultHTTPInvestigatingTpl.Subject || mon.Template.Fixed.Subject != defaultHTTPFixedTpl.Subject {
+		t.Error("heartbeat monitors should default to the HTTP templates")
+	}
+
+	mon.Name = "backup/nightly"
+	if errs := mon.Validate(); len(errs) != 1 || errs[0] != "Heartbeat monitor name cannot contain '/'" {
+		t.Errorf("unexpected validation errors: %v", errs)
+	}
+}
@@ -0,0 +1,152 @@
+package cachet
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"os/exec"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+)
+
+// DefaultHookTimeout in seconds
+const DefaultHookTimeout = 30
+
+// DefaultHookConcurrency is the number of hooks running at the same time
+const DefaultHookConcurrency = 4
+
+// HookPayload is the JSON document written to the hooks' stdin
+type HookPayload struct {
+	Hook        string `json:"hook"`
+	SystemName  string `json:"system_name"`
+	Monitor     string `json:"monitor"`
+	Type        string `json:"type"`
+	Target      string `json:"target"`
+	ComponentID int    `json:"component_id"`
+	// Component status (previous one for on_status_change)
+	Status         int       `json:"status"`
+	PreviousStatus int       `json:"previous_status,omitempty"`
+	History        []bool    `json:"history"`
+	FailReason     string    `json:"fail_reason,omitempty"`
+	IncidentID     int       `json:"incident_id,omitempty"`
+	Data           string    `json:"data,omitempty"`
+	Time           time.Time `json:"time"`
+}
+
+// hookPayload snapshots the monitor's state (hooks run later, in the background)
+func (mon *AbstractMonitor) hookPayload(hooktype string, data string) HookPayload {
+	payload := HookPayload{
+		Hook:        hooktype,
+		Monitor:     mon.Name,
+		Type:        mon.Type,
+		Target:      mon.Target,
+		ComponentID: mon.ComponentID,
+		Status:      mon.currentStatus,
+		History:     append([]bool{}, mon.history...),
+		FailReason:  mon.lastFailReason,
+		Data:        data,
+		Time:        time.Now(),
+	}
+	if mon.config != nil {
+		payload.SystemName = mon.config.SystemName
+	}
+	if mon.incident != nil {
+		payload.IncidentID = mon.incident.ID
+	}
+
+	return payload
+}
+
+func (mon *AbstractMonitor) triggerShellHook(l *logrus.Entry, hooktype string, hook string, data string) {
+	if len(hook) == 0 {
+		return
+	}
+
+	mon.runShellHook(l, hook, mon.hookPayload(hooktype, data))
+}
+
+// triggerStatusHook runs the 'on_status_change' hook when the component's status changed
+func (mon *AbstractMonitor) triggerStatusHook(l *logrus.Entry, previous int) {
+	if len(mon.ShellHookOnStatusChange) == 0 || previous == mon.currentStatus {
+		return
+	}
+
+	payload := mon.hookPayload("on_status_change", "")
+	payload.PreviousStatus = previous
+	mon.runShellHook(l, mon.ShellHookOnStatusChange, payload)
+}
+
+// runShellHook runs the hook in the background, killing it after HookTimeout seconds
+func (mon *AbstractMonitor) runShellHook(l *logrus.Entry, hook string, payload HookPayload) {
+	l.Infof("Sending '%s' shellhook", payload.Hook)
+	l.Debugf("Data: %s", payload.Data)
+
+	stdin, _ := json.Marshal(payload)
+	timeout := mon.HookTimeout
+	if timeout < 1 {
+		timeout = DefaultHookTimeout
+	}
+
+	// hooks are dropped rather than queued while all the slots are taken
+	slots, wg := mon.config.hookSlots()
+	select {
+	case slots <- struct{}{}:
+	default:
+		l.Warnf("Shellhook '%s' dropped: %d hooks already running", payload.Hook, cap(slots))
+		return
+	}
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer func() { <-slots }()
+
+		ctx, cancel := context.WithTimeout(context.Background(), timeout*time.Second)
+		defer cancel()
+
+		cmd := exec.CommandContext(ctx, hook, payload.Monitor, strconv.Itoa(payload.ComponentID), payload.Target, payload.Hook, payload.Data)
+		cmd.Env = append(os.Environ(),
+			"CACHET_HOOK="+payload.Hook,
+			"CACHET_SYSTEM_NAME="+payload.SystemName,
+			"CACHET_MONITOR="+payload.Monitor,
+			"CACHET_MONITOR_TYPE="+payload.Type,
+			"CACHET_TARGET="+payload.Target,
+			"CACHET_COMPONENT_ID="+strconv.Itoa(payload.ComponentID),
+			"CACHET_STATUS="+strconv.Itoa(payload.Status),
+			"CACHET_PREVIOUS_STATUS="+strconv.Itoa(payload.PreviousStatus),
+			"CACHET_FAIL_REASON="+payload.FailReason,
+			"CACHET_INCIDENT_ID="+strconv.Itoa(payload.IncidentID),
+		)
+		cmd.Stdin = bytes.NewReader(stdin)
+		cmd.WaitDelay = time.Second
+
+		out, err := cmd.Output()
+		if ctx.Err() == context.DeadlineExceeded {
+			l.Warnf("Shellhook '%s' killed after %ds", payload.Hook, timeout)
+		} else if err != nil {
+			l.Warnf("Error when processing shellhook '%s': %s", payload.Hook, err)
+			l.Warnf("Command output: %s", out)
+		}
+	}()
+}
+
+// hookSlots returns the semaphore bounding the running hooks and the group tracking them
+func (cfg *CachetMonitor) hookSlots() (chan struct{}, *sync.WaitGroup) {
+	cfg.hooksOnce.Do(func() {
+		if cfg.HookConcurrency < 1 {
+			cfg.HookConcurrency = DefaultHookConcurrency
+		}
+		cfg.hooks = make(chan struct{}, cfg.HookConcurrency)
+	})
+
+	return cfg.hooks, &cfg.hooksWg
+}
+
+// WaitHooks waits for the running hooks to complete
+func (cfg *CachetMonitor) WaitHooks() {
+	cfg.hooksWg.Wait()
+}
@@ -0,0 +1,90 @@
+package cachet
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+)
+
+func writeHook(t *testing.T, script string) string {
+	path := filepath.Join(t.TempDir(), "hook.sh")
+	if err := ioutil.WriteFile(path, []byte("#!/bin/sh\n"+script), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func TestShellHookPayload(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "out")
+	hook := writeHook(t, "cat > "+out+".json\necho \"$CACHET_HOOK $CACHET_STATUS $CACHET_PREVIOUS_STATUS $CACHET_INCIDENT_ID $1\" > "+out+".env\n")
+
+	cfg := &CachetMonitor{SystemName: "test"}
+	mon := &AbstractMonitor{Name: "web", ComponentID: 3, ShellHookOnStatusChange: hook, HookTimeout: 5, config: cfg}
+	mon.currentStatus = 4
+	mon.history = []bool{true, false}
+	mon.lastFailReason = "down"
+	mon.incident = &Incident{ID: 12}
+
+	l := logrus.WithFields(logrus.Fields{})
+	mon.triggerStatusHook(l, 4)
+	mon.triggerStatusHook(l, 1)
+	cfg.WaitHooks()
+
+	env, err := ioutil.ReadFile(out + ".env")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(env) != "on_status_change 4 1 12 web\n" {
+		t.Errorf("unexpected environment: %q", env)
+	}
+
+	data, err := ioutil.ReadFile(out + ".json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var payload HookPayload
+	if err := json.Unmarshal(data, &payload); err != nil {
+		t.Fatal(err)
+	}
+	if payload.SystemName != "test" || payload.ComponentID != 3 || payload.FailReason != "down" || len(payload.History) != 2 || payload.History[1] {
+		t.Errorf("unexpected payload: %+v", payload)
+	}
+}
+
+func TestShellHookTimeout(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "out")
+	hook := writeHook(t, "echo run >> "+out+"\nsleep 10\n")
+
+	cfg := &CachetMonitor{HookConcurrency: 1}
+	mon := &AbstractMonitor{Name: "web", HookTimeout: 1, config: cfg}
+	l := logrus.WithFields(logrus.Fields{})
+
+	start := time.Now()
+	mon.triggerShellHook(l, "on_failure", hook, "")
+	// no slot left: dropped
+	mon.triggerShellHook(l, "on_failure", hook, "")
+	if time.Since(start) > time.Second {
+		t.Errorf("hooks should not block the monitor")
+	}
+
+	cfg.WaitHooks()
+	// killed after a second
+	if elapsed := time.Since(start); elapsed < time.Second || elapsed > 5*time.Second {
+		t.Errorf("unexpected duration: %v", elapsed)
+	}
+	if runs, _ := ioutil.ReadFile(out); string(runs) != "run\n" {
+		t.Errorf("expected a single run, got %q", runs)
+	}
+
+	// the slot is free again
+	mon.triggerShellHook(l, "on_failure", hook, "")
+	cfg.WaitHooks()
+	if runs, _ := ioutil.ReadFile(out); string(runs) != "run\nrun\n" {
+		t.Errorf("expected a second run once the slot is free, got %q", runs)
+	}
+}
@@ -2,11 +2,15 @@ package cachet
 
 import (
 	"crypto/tls"
+	"errors"
 	"io/ioutil"
 	"net/http"
+	"net/http/httptrace"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/Sirupsen/logrus"
@@ -41,6 +45,74 @@ type HTTPMonitor struct {
 	ExpectedBody string `mapstructure:"expected_body"`
 	bodyRegexp   *regexp.Regexp
 	internalBodyRegexp   string
+
+	// Request phase (dns, connect, tls, first_byte, total) => metric IDs
+	TimingMetrics map[string][]int `mapstructure:"timing_metrics"`
+	// Request phase => milliseconds above which the component has performance issues
+	PerformanceThresholds map[string]int `mapstructure:"performance_thresholds"`
+
+	RedirectPolicy `mapstructure:",squash"`
+
+	Proxy *ProxyConfig
+	Auth  *HTTPAuth
+
+	// Fails when the body changes
+	Content *HTTPContent
+}
+
+// Request phases measured by HTTP monitors
+var httpPhases = []string{"dns", "connect", "tls", "first_byte", "total"}
+
+// httpTimings records the request phases
+type httpTimings struct {
+	start time.Time
+
+	// dialing may run concurrently (dual stack)
+	mu     sync.Mutex
+	starts map[string]time.Time
+	phases map[string]time.Duration
+}
+
+func newHTTPTimings() *httpTimings {
+	return &httpTimings{start: time.Now(), starts: map[string]time.Time{}, phases: map[string]time.Duration{}}
+}
+
+func (t *httpTimings) begin(phase string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.starts[phase] = time.Now()
+}
+
+func (t *httpTimings) end(phase string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	start, ok := t.starts[phase]
+	if !ok {
+		start = t.start
+	}
+	t.phases[phase] = time.Since(start)
+}
+
+func (t *httpTimings) get(phase string) (time.Duration, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	d, ok := t.phases[phase]
+	return d, ok
+}
+
+func (t *httpTimings) trace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		DNSStart:             func(httptrace.DNSStartInfo) { t.begin("dns") },
+		DNSDone:              func(httptrace.DNSDoneInfo) { t.end("dns") },
+		ConnectStart:         func(string, string) { t.begin("connect") },
+		ConnectDone:          func(string, string, error) { t.end("connect") },
+		TLSHandshakeStart:    func() { t.begin("tls") },
+		TLSHandshakeDone:     func(tls.ConnectionState, error) { t.end("tls") },
+		GotFirstResponseByte: func() { t.end("first_byte") },
+	}
 }
 
 func (monitor *HTTPMonitor) setBodyRegexp(errs []string) {
@@ -77,31 +149,62 @@ func (monitor *HTTPMonitor) test(l *logrus.Entry) bool {
 	client := &http.Client{
 		Timeout:   time.Duration(monitor.Timeout * time.Second),
 		Transport: &http.Transport{
+	                Proxy: monitor.Proxy.proxyFunc(),
 	                TLSClientConfig: &tls.Config{
 	                        InsecureSkipVerify: (! monitor.Strict),
 	                },
 		 },
+		CheckRedirect: monitor.checkRedirect,
 	}
 	l.Debugf("InsecureSkipVerify: %t", (! monitor.Strict))
 
+	if monitor.Auth != nil {
+		// the token endpoint does not get the monitor's redirect policy
+		tokenClient := &http.Client{Timeout: client.Timeout, Transport: client.Transport}
+		if err := monitor.Auth.apply(req, tokenClient); err != nil {
+			monitor.lastFailReason = err.Error()
+			l.Warnf("%s", monitor.lastFailReason)
+			return false
+		}
+	}
+
+	timings := newHTTPTimings()
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), timings.trace()))
+
 	resp, err := client.Do(req)
 	if err != nil {
 		monitor.lastFailReason = err.Error()
+		var redirectErr *redirectError
+		if errors.As(err, &redirectErr) {
+			monitor.lastFailReason = redirectErr.Error()
+		}
 		l.Infof("HTTP call failure: %s", monitor.lastFailReason)
 		return false
 	}
 
 	defer resp.Body.Close()
 
+	if resp.StatusCode == http.StatusUnauthorized && monitor.Auth != nil {
+		monitor.Auth.rejected()
+	}
+
 	if monitor.ExpectedStatusCode > 0 && resp.StatusCode != monitor.ExpectedStatusCode {
 		monitor.lastFailReason = "Expected HTTP response status: " + strconv.Itoa(monitor.ExpectedStatusCode) + ", got: " + strconv.Itoa(resp.StatusCode)
 		l.Infof("%s", monitor.lastFailReason)
 		return false
 	}
 
+	if err := monitor.checkResponse(resp); err != nil {
+		monitor.lastFailReason = err.Error()
+		l.Infof("%s", monitor.lastFailReason)
+		return false
+	}
+
 	monitor.setBodyRegexp(nil)
 
 	responseBody, err := ioutil.ReadAll(resp.Body)
+	timings.end("total")
+	monitor.sendTimings(l, timings)
 
 	if monitor.bodyRegexp != nil {
 		if err != nil {
@@ -116,11 +219,78 @@ func (monitor *HTTPMonitor) test(l *logrus.Entry) bool {
 		}
 	}
 
+	if monitor.Content != nil {
+		if err != nil {
+			monitor.lastFailReason = err.Error()
+			l.Infof("HTTP response error: %s", monitor.lastFailReason)
+			return false
+		}
+		if reason, severity := monitor.Content.check(l, responseBody); len(reason) > 0 {
+			monitor.lastFailReason = reason
+			monitor.severity = severity
+			l.Infof("%s", monitor.lastFailReason)
+			return false
+		}
+	}
+
+	if slow := monitor.slowPhases(timings); len(slow) > 0 {
+		monitor.lastFailReason = "Slow response: " + strings.Join(slow, ", ")
+		monitor.severity = 2
+		l.Infof("%s", monitor.lastFailReason)
+		return false
+	}
+
 	monitor.triggerShellHook(l, "on_success", monitor.ShellHookOnSuccess, string(responseBody))
 
 	return true
 }
 
+// sendTimings sends the request phases to their metrics (in milliseconds)
+func (monitor *HTTPMonitor) sendTimings(l *logrus.Entry, timings *httpTimings) {
+
+	if monitor.config == nil {
+		return
+	}
+	if writer, _ := monitor.config.isWriter(); !writer {
+		return
+	}
+
+	for phase, ids := range monitor.TimingMetrics {
+		if d, ok := timings.get(phase); ok {
+			go monitor.config.API.SendMetrics(l, phase+" time", ids, float64(d)/float64(time.Millisecond))
+		}
+	}
+}
+
+// slowPhases lists the phases above their performance threshold
+func (monitor *HTTPMonitor) slowPhases(timings *httpTimings) []string {
+	slow := []string{}
+	for _, phase := range httpPhases {
+		threshold, ok := monitor.PerformanceThresholds[phase]
+		if d, measured := timings.get(phase); ok && measured && d > time.Duration(threshold)*time.Millisecond {
+			slow = append(slow, phase+" "+strconv.FormatInt(d.Milliseconds(), 10)+"ms > "+strconv.Itoa(threshold)+"ms")
+		}
+	}
+
+	return slow
+}
+
+func validateHTTPPhases(option string, phases []string) []string {
+	errs := []string{}
+	sort.Strings(phases)
+	for _, phase := range phases {
+		known := false
+		for _, p := range httpPhases {
+			known = known || p == phase
+		}
+		if !known {
+			errs = append(errs, "Unknown request phase '"+phase+"' in '"+option+"' (expected "+strings.Join(httpPhases, ", ")+")")
+		}
+	}
+
+	return errs
+}
+
 // TODO: test
 func (mon *HTTPMonitor) Validate() []string {
 	mon.Template.Investigating.SetDefault(defaultHTTPInvestigatingTpl)
@@ -132,12 +302,36 @@ func (mon *HTTPMonitor) Validate() []string {
 		errs = append(errs, "'Target' has not been set")
 	}
 
-	if len(mon.ExpectedBody) == 0 && mon.ExpectedStatusCode == 0 {
+	if len(mon.ExpectedBody) == 0 && mon.ExpectedStatusCode == 0 && mon.Content == nil {
 		errs = append(errs, "Both 'expected_body' and 'expected_status_code' fields empty")
 	}
 
 	mon.setBodyRegexp(errs)
 
+	errs = append(errs, mon.RedirectPolicy.validate()...)
+	if mon.Proxy != nil {
+		errs = append(errs, mon.Proxy.Validate()...)
+	}
+	if mon.Auth != nil {
+		errs = append(errs, mon.Auth.Validate()...)
+	}
+	if mon.Content != nil {
+		mon.Content.key = "content/" + mon.Name
+		errs = append(errs, mon.Content.Validate()...)
+	}
+
+	phases := []string{}
+	for phase := range mon.TimingMetrics {
+		phases = append(phases, phase)
+	}
+	errs = append(errs, validateHTTPPhases("timing_metrics", phases)...)
+
+	phases = []string{}
+	for phase := range mon.PerformanceThresholds {
+		phases = append(phases, phase)
+	}
+	errs = append(errs, validateHTTPPhases("performance_thresholds", phases)...)
+
 	mon.Method = strings.ToUpper(mon.Method)
 	switch mon.Method {
 		case "GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS", "HEAD":
@@ -155,6 +349,24 @@ func (mon *HTTPMonitor) Describe() []string {
 	features := mon.AbstractMonitor.Describe()
 	features = append(features, "Method: "+mon.Method)
 	features = append(features, "Insecure: "+ strconv.FormatBool(!mon.Strict))
+	features = append(features, mon.RedirectPolicy.describe()...)
+	if mon.Proxy != nil {
+		features = append(features, "Proxy: "+mon.Proxy.String())
+	}
+	if mon.Auth != nil {
+		features = append(features, "Auth: "+mon.Auth.String())
+	}
+	if mon.Content != nil {
+		features = append(features, "Content: "+mon.Content.String())
+	}
+	if len(mon.TimingMetrics) > 0 {
+		features = append(features, "Timing metrics: "+strconv.Itoa(len(mon.TimingMetrics)))
+	}
+	for _, phase := range httpPhases {
+		if threshold, ok := mon.PerformanceThresholds[phase]; ok {
+			features = append(features, "Performance threshold ("+phase+"): "+strconv.Itoa(threshold)+"ms")
+		}
+	}
 
 	return features
 }
@@ -0,0 +1,97 @@
+package cachet
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+)
+
+func TestHTTPMonitorPerformanceThresholds(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(50 * time.Millisecond)
+		w.Write([]byte("OK"))
+	}))
+	defer server.Close()
+
+	l := logrus.WithFields(logrus.Fields{})
+	mon := &HTTPMonitor{ExpectedStatusCode: 200, PerformanceThresholds: map[string]int{"connect": 1000, "first_byte": 1000}}
+	mon.Name, mon.Target, mon.ComponentID, mon.Timeout = "http", server.URL, 1, 1
+	if errs := mon.Validate(); len(errs) > 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+
+	if !mon.test(l) {
+		t.Errorf("check should have passed: %s", mon.lastFailReason)
+	}
+
+	mon.PerformanceThresholds["first_byte"] = 10
+	if mon.test(l) || mon.severity != 2 || !strings.HasPrefix(mon.lastFailReason, "Slow response: first_byte ") {
+		t.Errorf("check should have been slow: %s (severity %d)", mon.lastFailReason, mon.severity)
+	}
+
+	mon.TimingMetrics = map[string][]int{"ttfb": {1}}
+	if errs := mon.Validate(); len(errs) != 1 || !strings.HasPrefix(errs[0], "Unknown request phase 'ttfb'") {
+		t.Errorf("unexpected errors: %v", errs)
+	}
+}
+
+func TestHTTPMonitorRedirects(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/loop", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/login", http.StatusFound)
+	})
+	mux.HandleFunc("/login", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/loop", http.StatusFound)
+	})
+	mux.HandleFunc("/away", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "http://example.invalid/", http.StatusMovedPermanently)
+	})
+	mux.HandleFunc("/home", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/dashboard", http.StatusFound)
+	})
+	mux.HandleFunc("/dashboard", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("OK"))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	l := logrus.WithFields(logrus.Fields{})
+	mon := &HTTPMonitor{ExpectedStatusCode: 200}
+	mon.Name, mon.Target, mon.ComponentID, mon.Timeout = "http", server.URL+"/loop", 1, 1
+	mon.FollowRedirects = 3
+	mon.Validate()
+
+	if mon.test(l) || !strings.HasPrefix(mon.lastFailReason, "Stopped after 3 redirects: "+server.URL+"/loop -> "+server.URL+"/login") {
+		t.Errorf("unexpected fail reason: %s", mon.lastFailReason)
+	}
+
+	mon.Target = server.URL + "/home"
+	mon.ExpectedURL = "/dashboard$"
+	mon.Validate()
+	if !mon.test(l) {
+		t.Errorf("check should have passed: %s", mon.lastFailReason)
+	}
+
+	mon.ExpectedURL = "/login$"
+	mon.Validate()
+	if mon.test(l) || mon.lastFailReason != "Unexpected final URL: "+server.URL+"/dashboard.\nExpected to match: /login$" {
+		t.Errorf("unexpected fail reason: %s", mon.lastFailReason)
+	}
+
+	// not following: assert the redirect itself
+	mon.ExpectedStatusCode, mon.FollowRedirects, mon.ExpectedURL, mon.ExpectedLocation = 302, false, "", "^/dashboard$"
+	mon.Validate()
+	if !mon.test(l) {
+		t.Errorf("check should have passed: %s", mon.lastFailReason)
+	}
+
+	mon.Target, mon.ExpectedStatusCode, mon.ExpectedLocation, mon.FollowRedirects, mon.RedirectSameHost = server.URL+"/away", 200, "", true, true
+	mon.Validate()
+	if mon.test(l) || mon.lastFailReason != "Redirected to another host: "+server.URL+"/away -> http://example.invalid/" {
+		t.Errorf("unexpected fail reason: %s", mon.lastFailReason)
+	}
+}
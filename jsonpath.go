@@ -0,0 +1,99 @@
+package cachet
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// parseJSONPath splits a simple JSON path ($.data.items[0].id, $['a key']) into
+// object keys (string) and array indexes (int)
+func parseJSONPath(path string) ([]interface{}, error) {
+	path = strings.TrimPrefix(strings.TrimSpace(path), "$")
+	segments := []interface{}{}
+
+	for len(path) > 0 {
+		switch path[0] {
+		case '.':
+			path = path[1:]
+			end := strings.IndexAny(path, ".[")
+			if end < 0 {
+				end = len(path)
+			}
+			if end == 0 {
+				return nil, errors.New("empty key in JSON path")
+			}
+			segments = append(segments, path[:end])
+			path = path[end:]
+		case '[':
+			end := strings.Index(path, "]")
+			if end < 0 {
+				return nil, errors.New("unterminated '[' in JSON path")
+			}
+			inner := path[1:end]
+			path = path[end+1:]
+
+			if len(inner) >= 2 && (inner[0] == '\'' || inner[0] == '"') && inner[len(inner)-1] == inner[0] {
+				segments = append(segments, inner[1:len(inner)-1])
+				continue
+			}
+			index, err := strconv.Atoi(inner)
+			if err != nil {
+				return nil, errors.New("invalid index '" + inner + "' in JSON path")
+			}
+			segments = append(segments, index)
+		default:
+			// leading key without '$.'
+			path = "." + path
+		}
+	}
+
+	return segments, nil
+}
+
+// jsonPathLookup returns the value found at path in a decoded JSON document
+func jsonPathLookup(doc interface{}, path string) (interface{}, error) {
+	segments, err := parseJSONPath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	value := doc
+	for _, segment := range segments {
+		switch s := segment.(type) {
+		case string:
+			object, ok := value.(map[string]interface{})
+			if !ok {
+				return nil, errors.New("'" + s + "' not found in " + path + " (not an object)")
+			}
+			if value, ok = object[s]; !ok {
+				return nil, errors.New("'" + s + "' not found in " + path)
+			}
+		case int:
+			array, ok := value.([]interface{})
+			if !ok {
+				return nil, errors.New("[" + strconv.Itoa(s) + "] not found in " + path + " (not an array)")
+			}
+			if s < 0 {
+				s += len(array)
+			}
+			if s < 0 || s >= len(array) {
+				return nil, errors.New("[" + strconv.Itoa(s) + "] out of range in " + path)
+			}
+			value = array[s]
+		}
+	}
+
+	return value, nil
+}
+
+// jsonValueString formats a JSON value: strings as is, anything else JSON encoded
+func jsonValueString(value interface{}) string {
+	if s, ok := value.(string); ok {
+		return s
+	}
+
+	data, _ := json.Marshal(value)
+	return string(data)
+}
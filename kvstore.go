@@ -0,0 +1,215 @@
+package cachet
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const kvPrefix = "/kv/"
+
+// KVServer is a simple in-memory HTTP key/value store which can be shared by
+// cachet-monitor instances that have no shared storage
+//
+//	GET    /kv/<key>        value (404 when missing) and its ETag
+//	PUT    /kv/<key>        store the request body, honouring If-Match / If-None-Match: *
+//	GET    /kv/?prefix=<p>  JSON object of all keys starting with p
+type KVServer struct {
+	Token string
+
+	mu   sync.Mutex
+	data map[string][]byte
+}
+
+func NewKVServer(token string) *KVServer {
+	return &KVServer{
+		Token: token,
+		data:  map[string][]byte{},
+	}
+}
+
+func (s *KVServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if len(s.Token) > 0 && r.Header.Get("Authorization") != "Bearer "+s.Token {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	path := r.URL.EscapedPath()
+	if !strings.HasPrefix(path, kvPrefix) {
+		http.NotFound(w, r)
+		return
+	}
+
+	key, err := url.PathUnescape(path[len(kvPrefix):])
+	if err != nil {
+		http.Error(w, "invalid key", http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch {
+	case r.Method == "GET" && len(key) == 0:
+		prefix := r.URL.Query().Get("prefix")
+		values := map[string][]byte{}
+		for k, v := range s.data {
+			if strings.HasPrefix(k, prefix) {
+				values[k] = v
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(values)
+	case r.Method == "GET":
+		value, ok := s.data[key]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+
+		w.Header().Set("ETag", kvETag(value))
+		w.Write(value)
+	case r.Method == "PUT" && len(key) > 0:
+		value, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		// compare and swap
+		current, exists := s.data[key]
+		if match := r.Header.Get("If-Match"); len(match) > 0 && (!exists || match != kvETag(current)) {
+			w.WriteHeader(http.StatusPreconditionFailed)
+			return
+		}
+		if r.Header.Get("If-None-Match") == "*" && exists {
+			w.WriteHeader(http.StatusPreconditionFailed)
+			return
+		}
+
+		s.data[key] = value
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// HTTPStore is the client side of KVServer
+type HTTPStore struct {
+	URL   string
+	Token string
+
+	client *http.Client
+}
+
+func NewHTTPStore(baseURL string, token string) *HTTPStore {
+	return &HTTPStore{
+		URL:    strings.TrimRight(baseURL, "/"),
+		Token:  token,
+		client: &http.Client{Timeout: 5 * time.Second},
+	}
+}
+
+func kvETag(value []byte) string {
+	sum := sha1.Sum(value)
+	return `"` + hex.EncodeToString(sum[:]) + `"`
+}
+
+func (s *HTTPStore) do(method string, path string, body []byte, headers ...string) (*http.Response, []byte, error) {
+	req, err := http.NewRequest(method, s.URL+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, nil, err
+	}
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+	if len(s.Token) > 0 {
+		req.Header.Set("Authorization", "Bearer "+s.Token)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(resp.Body)
+
+	return resp, data, err
+}
+
+func (s *HTTPStore) Get(key string) ([]byte, error) {
+	resp, data, err := s.do("GET", kvPrefix+url.PathEscape(key), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return data, nil
+	case http.StatusNotFound:
+		return nil, nil
+	}
+
+	return nil, errors.New("store responded with status " + strconv.Itoa(resp.StatusCode))
+}
+
+func (s *HTTPStore) Put(key string, value []byte) error {
+	resp, _, err := s.do("PUT", kvPrefix+url.PathEscape(key), value)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode/100 != 2 {
+		return errors.New("store responded with status " + strconv.Itoa(resp.StatusCode))
+	}
+
+	return nil
+}
+
+func (s *HTTPStore) List(prefix string) (map[string][]byte, error) {
+	resp, data, err := s.do("GET", kvPrefix+"?prefix="+url.QueryEscape(prefix), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.New("store responded with status " + strconv.Itoa(resp.StatusCode))
+	}
+
+	values := map[string][]byte{}
+	err = json.Unmarshal(data, &values)
+
+	return values, err
+}
+
+func (s *HTTPStore) CompareAndSwap(key string, old []byte, value []byte) (bool, error) {
+	precondition := []string{"If-None-Match", "*"}
+	if old != nil {
+		precondition = []string{"If-Match", kvETag(old)}
+	}
+
+	resp, _, err := s.do("PUT", kvPrefix+url.PathEscape(key), value, precondition...)
+	if err != nil {
+		return false, err
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusPreconditionFailed:
+		return false, nil
+	case resp.StatusCode/100 != 2:
+		return false, errors.New("store responded with status " + strconv.Itoa(resp.StatusCode))
+	}
+
+	return true, nil
+}
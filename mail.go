@@ -0,0 +1,533 @@
+package cachet
+
+import (
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"net/textproto"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+)
+
+// DefaultMailDeadline in seconds
+const DefaultMailDeadline = 30
+
+// Default ports: plain (or STARTTLS) / implicit TLS
+var mailPorts = map[string][2]string{
+	"smtp": {"25", "465"},
+	"imap": {"143", "993"},
+	"pop3": {"110", "995"},
+}
+
+// MailMonitor checks a SMTP, IMAP or POP3 server (see Type)
+type MailMonitor struct {
+	AbstractMonitor `mapstructure:",squash"`
+
+	// Implicit TLS (smtps, imaps, pop3s)
+	TLS      bool
+	StartTLS bool `mapstructure:"starttls"`
+	Username string
+	Password string
+
+	// Regexp the server's greeting has to match
+	ExpectedGreeting string `mapstructure:"expected_greeting"`
+	greetingRegexp   *regexp.Regexp
+
+	// SMTP only: a message is sent to this address (and picked up with Receive when set)
+	SendTo  string `mapstructure:"send_to"`
+	From    string
+	Receive *MailReceive
+}
+
+// MailReceive is the IMAP mailbox expected to get the message sent by the SMTP monitor
+type MailReceive struct {
+	Target   string
+	TLS      bool
+	StartTLS bool `mapstructure:"starttls"`
+	// Default to the monitor's credentials
+	Username string
+	Password string
+	Mailbox  string
+	// Seconds to wait for the message
+	Deadline time.Duration
+}
+
+// mailSession is a line based connection to a mail server
+type mailSession struct {
+	host string
+	conn net.Conn
+	tp   *textproto.Conn
+	tag  int
+}
+
+func (monitor *MailMonitor) test(l *logrus.Entry) bool {
+	var err error
+	switch monitor.Type {
+	case "imap":
+		err = monitor.testIMAP(monitor.Target, monitor.TLS, monitor.StartTLS, monitor.Username, monitor.Password, nil)
+	case "pop3":
+		err = monitor.testPOP3()
+	default:
+		err = monitor.testSMTP(l)
+	}
+
+	if err != nil {
+		monitor.lastFailReason = err.Error()
+		l.Infof("Mail check failure: %s", monitor.lastFailReason)
+		return false
+	}
+
+	monitor.triggerShellHook(l, "on_success", monitor.ShellHookOnSuccess, "")
+
+	return true
+}
+
+func (monitor *MailMonitor) dial(target string, implicitTLS bool, protocol string) (*mailSession, error) {
+	host, port, err := net.SplitHostPort(target)
+	if err != nil {
+		host = target
+		port = mailPorts[protocol][0]
+		if implicitTLS {
+			port = mailPorts[protocol][1]
+		}
+	}
+
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(host, port), monitor.Timeout*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	conn.SetDeadline(time.Now().Add(monitor.Timeout * time.Second))
+
+	s := &mailSession{host: host, conn: conn, tp: textproto.NewConn(conn)}
+	if implicitTLS {
+		if err := s.upgrade(monitor.Strict); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+
+	return s, nil
+}
+
+// upgrade starts TLS on the connection (certificate verified unless not strict)
+func (s *mailSession) upgrade(strict bool) error {
+	conn := tls.Client(s.conn, &tls.Config{ServerName: s.host, InsecureSkipVerify: !strict})
+	if err := conn.Handshake(); err != nil {
+		return errors.New("TLS handshake failed: " + err.Error())
+	}
+
+	s.conn = conn
+	s.tp = textproto.NewConn(conn)
+
+	return nil
+}
+
+func (s *mailSession) Close() {
+	s.tp.Close()
+}
+
+func (monitor *MailMonitor) checkGreeting(greeting string) error {
+	if monitor.greetingRegexp != nil && !monitor.greetingRegexp.MatchString(greeting) {
+		return errors.New("Unexpected greeting: " + greeting + ".\nExpected to match: " + monitor.ExpectedGreeting)
+	}
+
+	return nil
+}
+
+// smtpCmd sends a command and reads the response (expectCode as in textproto.ReadResponse)
+func (s *mailSession) smtpCmd(expectCode int, format string, args ...interface{}) (string, error) {
+	id, err := s.tp.Cmd(format, args...)
+	if err != nil {
+		return "", err
+	}
+	s.tp.StartResponse(id)
+	defer s.tp.EndResponse(id)
+
+	_, msg, err := s.tp.ReadResponse(expectCode)
+	if err != nil {
+		return "", smtpError("SMTP: ", err)
+	}
+
+	return msg, nil
+}
+
+// smtpError keeps the server's reply readable (textproto quotes it)
+func smtpError(prefix string, err error) error {
+	if e, ok := err.(*textproto.Error); ok {
+		return errors.New(prefix + strconv.Itoa(e.Code) + " " + e.Msg)
+	}
+
+	return errors.New(prefix + err.Error())
+}
+
+func (monitor *MailMonitor) testSMTP(l *logrus.Entry) error {
+	s, err := monitor.dial(monitor.Target, monitor.TLS, "smtp")
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	_, greeting, err := s.tp.ReadResponse(220)
+	if err != nil {
+		return smtpError("SMTP greeting: ", err)
+	}
+	if err := monitor.checkGreeting(greeting); err != nil {
+		return err
+	}
+
+	hostname, _ := os.Hostname()
+	if len(hostname) == 0 {
+		hostname = "localhost"
+	}
+
+	extensions, err := s.smtpCmd(250, "EHLO %s", hostname)
+	if err != nil {
+		return err
+	}
+
+	if monitor.StartTLS {
+		if !strings.Contains(extensions, "STARTTLS") {
+			return errors.New("SMTP: STARTTLS is not supported by the server")
+		}
+		if _, err := s.smtpCmd(220, "STARTTLS"); err != nil {
+			return err
+		}
+		if err := s.upgrade(monitor.Strict); err != nil {
+			return err
+		}
+		if _, err := s.smtpCmd(250, "EHLO %s", hostname); err != nil {
+			return err
+		}
+	}
+
+	if len(monitor.Username) > 0 {
+		auth := base64.StdEncoding.EncodeToString([]byte("\x00" + monitor.Username + "\x00" + monitor.Password))
+		if _, err := s.smtpCmd(235, "AUTH PLAIN %s", auth); err != nil {
+			return err
+		}
+	}
+
+	if len(monitor.SendTo) == 0 {
+		s.smtpCmd(221, "QUIT")
+		return nil
+	}
+
+	token := strconv.FormatInt(time.Now().UnixNano(), 36)
+	if err := monitor.sendMessage(s, hostname, token); err != nil {
+		return err
+	}
+	s.smtpCmd(221, "QUIT")
+	l.Debugf("Message %s sent to %s", token, monitor.SendTo)
+
+	if monitor.Receive == nil {
+		return nil
+	}
+
+	return monitor.waitMessage(l, token)
+}
+
+func (monitor *MailMonitor) sendMessage(s *mailSession, hostname string, token string) error {
+	if _, err := s.smtpCmd(250, "MAIL FROM:<%s>", monitor.From); err != nil {
+		return err
+	}
+	if _, err := s.smtpCmd(25, "RCPT TO:<%s>", monitor.SendTo); err != nil {
+		return err
+	}
+	if _, err := s.smtpCmd(354, "DATA"); err != nil {
+		return err
+	}
+
+	w := s.tp.DotWriter()
+	fmt.Fprintf(w, "From: <%s>\r\nTo: <%s>\r\nSubject: cachet-monitor %s %s\r\nDate: %s\r\nMessage-ID: <%s@%s>\r\n\r\n",
+		monitor.From, monitor.SendTo, monitor.Name, token, time.Now().Format(time.RFC1123Z), token, hostname)
+	fmt.Fprintf(w, "Delivery check sent by cachet-monitor (%s).\r\n", monitor.Name)
+	if err := w.Close(); err != nil {
+		return err
+	}
+
+	if _, _, err := s.tp.ReadResponse(250); err != nil {
+		return smtpError("SMTP: ", err)
+	}
+
+	return nil
+}
+
+// waitMessage polls the IMAP mailbox until the message shows up (or the deadline)
+func (monitor *MailMonitor) waitMessage(l *logrus.Entry, token string) error {
+	r := monitor.Receive
+	deadline := time.Now().Add(r.Deadline * time.Second)
+
+	for {
+		found := false
+		err := monitor.testIMAP(r.Target, r.TLS, r.StartTLS, r.Username, r.Password, func(s *mailSession) error {
+			var err error
+			found, err = s.imapPickMessage(r.Mailbox, token)
+			return err
+		})
+		if err != nil {
+			return errors.New("Receiving: " + err.Error())
+		}
+		if found {
+			l.Debugf("Message %s received", token)
+			return nil
+		}
+
+		if time.Now().After(deadline) {
+			return errors.New("Message sent to " + monitor.SendTo + " not received within " + strconv.Itoa(int(r.Deadline)) + "s")
+		}
+
+		select {
+		case <-time.After(time.Second):
+		case <-monitor.stopC:
+			return errors.New("Monitor stopped")
+		}
+	}
+}
+
+// imapCmd sends a tagged command and returns the untagged responses
+func (s *mailSession) imapCmd(format string, args ...interface{}) ([]string, error) {
+	s.tag++
+	tag := "a" + strconv.Itoa(s.tag)
+	if err := s.tp.PrintfLine(tag+" "+format, args...); err != nil {
+		return nil, err
+	}
+
+	untagged := []string{}
+	for {
+		line, err := s.tp.ReadLine()
+		if err != nil {
+			return nil, err
+		}
+
+		if strings.HasPrefix(line, tag+" ") {
+			status := strings.TrimPrefix(line, tag+" ")
+			if !strings.HasPrefix(status, "OK") {
+				return nil, errors.New("IMAP: " + status)
+			}
+			return untagged, nil
+		}
+		untagged = append(untagged, line)
+	}
+}
+
+// imapPickMessage looks for the message and removes it
+func (s *mailSession) imapPickMessage(mailbox string, token string) (bool, error) {
+	if _, err := s.imapCmd("SELECT %s", imapQuote(mailbox)); err != nil {
+		return false, err
+	}
+
+	untagged, err := s.imapCmd("UID SEARCH HEADER Subject %s", imapQuote(token))
+	if err != nil {
+		return false, err
+	}
+
+	uids := []string{}
+	for _, line := range untagged {
+		if strings.HasPrefix(line, "* SEARCH") {
+			uids = append(uids, strings.Fields(strings.TrimPrefix(line, "* SEARCH"))...)
+		}
+	}
+	if len(uids) == 0 {
+		return false, nil
+	}
+
+	if _, err := s.imapCmd("UID STORE %s +FLAGS.SILENT (\\Deleted)", strings.Join(uids, ",")); err != nil {
+		return true, err
+	}
+	_, err = s.imapCmd("EXPUNGE")
+
+	return true, err
+}
+
+func (monitor *MailMonitor) testIMAP(target string, implicitTLS bool, startTLS bool, username string, password string, fn func(*mailSession) error) error {
+	s, err := monitor.dial(target, implicitTLS, "imap")
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	greeting, err := s.tp.ReadLine()
+	if err != nil {
+		return errors.New("IMAP greeting: " + err.Error())
+	}
+	if !strings.HasPrefix(greeting, "* OK") && !strings.HasPrefix(greeting, "* PREAUTH") {
+		return errors.New("IMAP greeting: " + greeting)
+	}
+	if fn == nil {
+		if err := monitor.checkGreeting(greeting); err != nil {
+			return err
+		}
+	}
+
+	if startTLS {
+		if _, err := s.imapCmd("STARTTLS"); err != nil {
+			return err
+		}
+		if err := s.upgrade(monitor.Strict); err != nil {
+			return err
+		}
+	}
+
+	if len(username) > 0 {
+		if _, err := s.imapCmd("LOGIN %s %s", imapQuote(username), imapQuote(password)); err != nil {
+			return err
+		}
+	}
+
+	if fn != nil {
+		if err := fn(s); err != nil {
+			return err
+		}
+	}
+
+	s.imapCmd("LOGOUT")
+
+	return nil
+}
+
+// pop3Cmd sends a command and returns the +OK response
+func (s *mailSession) pop3Cmd(format string, args ...interface{}) (string, error) {
+	if err := s.tp.PrintfLine(format, args...); err != nil {
+		return "", err
+	}
+
+	return s.pop3Response()
+}
+
+func (s *mailSession) pop3Response() (string, error) {
+	line, err := s.tp.ReadLine()
+	if err != nil {
+		return "", err
+	}
+	if !strings.HasPrefix(line, "+OK") {
+		return "", errors.New("POP3: " + line)
+	}
+
+	return line, nil
+}
+
+func (monitor *MailMonitor) testPOP3() error {
+	s, err := monitor.dial(monitor.Target, monitor.TLS, "pop3")
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	greeting, err := s.pop3Response()
+	if err != nil {
+		return errors.New("POP3 greeting: " + err.Error())
+	}
+	if err := monitor.checkGreeting(greeting); err != nil {
+		return err
+	}
+
+	if monitor.StartTLS {
+		if _, err := s.pop3Cmd("STLS"); err != nil {
+			return err
+		}
+		if err := s.upgrade(monitor.Strict); err != nil {
+			return err
+		}
+	}
+
+	if len(monitor.Username) > 0 {
+		if _, err := s.pop3Cmd("USER %s", monitor.Username); err != nil {
+			return err
+		}
+		if _, err := s.pop3Cmd("PASS %s", monitor.Password); err != nil {
+			return err
+		}
+		if _, err := s.pop3Cmd("STAT"); err != nil {
+			return err
+		}
+	}
+
+	s.pop3Cmd("QUIT")
+
+	return nil
+}
+
+func imapQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+func (mon *MailMonitor) Validate() []string {
+	mon.Template.Investigating.SetDefault(defaultHTTPInvestigatingTpl)
+	mon.Template.Fixed.SetDefault(defaultHTTPFixedTpl)
+
+	errs := mon.AbstractMonitor.Validate()
+
+	if len(mon.Target) == 0 {
+		errs = append(errs, "'Target' has not been set")
+	}
+
+	if mon.TLS && mon.StartTLS {
+		errs = append(errs, "'tls' and 'starttls' are exclusive")
+	}
+
+	mon.greetingRegexp = nil
+	if len(mon.ExpectedGreeting) > 0 {
+		exp, err := regexp.Compile(mon.ExpectedGreeting)
+		if err != nil {
+			errs = append(errs, "Regexp compilation failure: "+err.Error())
+		}
+		mon.greetingRegexp = exp
+	}
+
+	if len(mon.SendTo) > 0 && mon.Type != "smtp" {
+		errs = append(errs, "'send_to' is only supported by smtp monitors")
+	}
+	if len(mon.From) == 0 {
+		mon.From = mon.SendTo
+	}
+
+	if r := mon.Receive; r != nil {
+		if len(mon.SendTo) == 0 {
+			errs = append(errs, "'receive' requires 'send_to'")
+		}
+		if len(r.Target) == 0 {
+			errs = append(errs, "'receive' target has not been set")
+		}
+		if r.TLS && r.StartTLS {
+			errs = append(errs, "'receive': 'tls' and 'starttls' are exclusive")
+		}
+		if len(r.Username) == 0 {
+			r.Username, r.Password = mon.Username, mon.Password
+		}
+		if len(r.Mailbox) == 0 {
+			r.Mailbox = "INBOX"
+		}
+		if r.Deadline < 1 {
+			r.Deadline = DefaultMailDeadline
+		}
+		if 2*mon.Timeout+r.Deadline > mon.Interval {
+			errs = append(errs, "Send-to-self (timeouts and deadline) does not fit within the interval")
+		}
+	}
+
+	return errs
+}
+
+func (mon *MailMonitor) Describe() []string {
+	features := mon.AbstractMonitor.Describe()
+	features = append(features, "TLS: "+strconv.FormatBool(mon.TLS)+", STARTTLS: "+strconv.FormatBool(mon.StartTLS))
+	features = append(features, "Insecure: "+strconv.FormatBool(!mon.Strict))
+	if len(mon.Username) > 0 {
+		features = append(features, "Authenticated as: "+mon.Username)
+	}
+	if len(mon.SendTo) > 0 {
+		features = append(features, "Sends a message to: "+mon.SendTo)
+	}
+	if mon.Receive != nil {
+		features = append(features, "Expects it in "+mon.Receive.Target+" ("+mon.Receive.Mailbox+") within "+strconv.Itoa(int(mon.Receive.Deadline))+"s")
+	}
+
+	return features
+}
@@ -0,0 +1,219 @@
+package cachet
+
+import (
+	"encoding/base64"
+	"net"
+	"net/textproto"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/Sirupsen/logrus"
+)
+
+// fakeMailServer is a minimal SMTP/IMAP/POP3 stand-in delivering to a single mailbox
+type fakeMailServer struct {
+	username string
+	password string
+	deliver  bool
+
+	mu       sync.Mutex
+	messages []string
+}
+
+func (f *fakeMailServer) listen(t *testing.T, handler func(*textproto.Conn)) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				tp := textproto.NewConn(conn)
+				defer tp.Close()
+				handler(tp)
+			}()
+		}
+	}()
+
+	return ln.Addr().String()
+}
+
+func (f *fakeMailServer) smtp(tp *textproto.Conn) {
+	tp.PrintfLine("220 fake ESMTP ready")
+	for {
+		line, err := tp.ReadLine()
+		if err != nil {
+			return
+		}
+
+		switch cmd := strings.ToUpper(strings.Fields(line + " ")[0]); cmd {
+		case "EHLO":
+			tp.PrintfLine("250-fake\r\n250 AUTH PLAIN")
+		case "AUTH":
+			auth, _ := base64.StdEncoding.DecodeString(strings.TrimPrefix(line, "AUTH PLAIN "))
+			if string(auth) == "\x00"+f.username+"\x00"+f.password {
+				tp.PrintfLine("235 ok")
+			} else {
+				tp.PrintfLine("535 authentication failed")
+			}
+		case "MAIL", "RCPT":
+			tp.PrintfLine("250 ok")
+		case "DATA":
+			tp.PrintfLine("354 go ahead")
+			data, _ := tp.ReadDotBytes()
+			if f.deliver {
+				f.mu.Lock()
+				f.messages = append(f.messages, string(data))
+				f.mu.Unlock()
+			}
+			tp.PrintfLine("250 queued")
+		case "QUIT":
+			tp.PrintfLine("221 bye")
+			return
+		default:
+			tp.PrintfLine("502 unknown command")
+		}
+	}
+}
+
+func (f *fakeMailServer) imap(tp *textproto.Conn) {
+	tp.PrintfLine("* OK fake IMAP ready")
+	for {
+		line, err := tp.ReadLine()
+		if err != nil {
+			return
+		}
+
+		fields := strings.SplitN(line, " ", 2)
+		tag, cmd := fields[0], fields[1]
+		switch {
+		case strings.HasPrefix(cmd, "LOGIN"):
+			if cmd != "LOGIN "+imapQuote(f.username)+" "+imapQuote(f.password) {
+				tp.PrintfLine("%s NO authentication failed", tag)
+				continue
+			}
+		case strings.HasPrefix(cmd, "UID SEARCH HEADER Subject "):
+			token := strings.Trim(strings.TrimPrefix(cmd, "UID SEARCH HEADER Subject "), `"`)
+			uids := []string{}
+			f.mu.Lock()
+			for i, m := range f.messages {
+				if strings.Contains(m, token) {
+					uids = append(uids, string(rune('1'+i)))
+				}
+			}
+			f.mu.Unlock()
+			tp.PrintfLine("* SEARCH %s", strings.Join(uids, " "))
+		case cmd == "EXPUNGE":
+			f.mu.Lock()
+			f.messages = nil
+			f.mu.Unlock()
+		case cmd == "LOGOUT":
+			tp.PrintfLine("* BYE")
+			tp.PrintfLine("%s OK", tag)
+			return
+		}
+		tp.PrintfLine("%s OK done", tag)
+	}
+}
+
+func (f *fakeMailServer) pop3(tp *textproto.Conn) {
+	tp.PrintfLine("+OK fake POP3 ready")
+	user := ""
+	for {
+		line, err := tp.ReadLine()
+		if err != nil {
+			return
+		}
+
+		switch {
+		case strings.HasPrefix(line, "USER "):
+			user = strings.TrimPrefix(line, "USER ")
+			tp.PrintfLine("+OK")
+		case strings.HasPrefix(line, "PASS "):
+			if user != f.username || line != "PASS "+f.password {
+				tp.PrintfLine("-ERR invalid credentials")
+				continue
+			}
+			tp.PrintfLine("+OK logged in")
+		case line == "QUIT":
+			tp.PrintfLine("+OK bye")
+			return
+		default:
+			tp.PrintfLine("+OK 0 0")
+		}
+	}
+}
+
+func TestMailMonitorSendToSelf(t *testing.T) {
+	f := &fakeMailServer{username: "monitor", password: "p\"w", deliver: true}
+	smtp := f.listen(t, f.smtp)
+	imap := f.listen(t, f.imap)
+	l := logrus.WithFields(logrus.Fields{})
+
+	mon := &MailMonitor{Username: "monitor", Password: "p\"w", SendTo: "monitor@example.com", ExpectedGreeting: "ESMTP"}
+	mon.Name, mon.Type, mon.Target, mon.ComponentID = "mail", "smtp", smtp, 1
+	mon.Interval, mon.Timeout = 10, 2
+	mon.Receive = &MailReceive{Target: imap, Deadline: 3}
+	if errs := mon.Validate(); len(errs) > 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+
+	if !mon.test(l) {
+		t.Fatalf("check should have passed: %s", mon.lastFailReason)
+	}
+	if len(f.messages) != 0 {
+		t.Errorf("message should have been removed")
+	}
+
+	// stuck queue
+	f.deliver = false
+	mon.Receive.Deadline = 1
+	if mon.test(l) || !strings.Contains(mon.lastFailReason, "not received within 1s") {
+		t.Errorf("check should have failed: %s", mon.lastFailReason)
+	}
+
+	// broken auth
+	mon.Password = "wrong"
+	if mon.test(l) || mon.lastFailReason != "SMTP: 535 authentication failed" {
+		t.Errorf("unexpected fail reason: %s", mon.lastFailReason)
+	}
+}
+
+func TestMailMonitorGreetingAndLogin(t *testing.T) {
+	f := &fakeMailServer{username: "monitor", password: "secret"}
+	pop3 := f.listen(t, f.pop3)
+	imap := f.listen(t, f.imap)
+	l := logrus.WithFields(logrus.Fields{})
+
+	mon := &MailMonitor{Username: "monitor", Password: "secret"}
+	mon.Name, mon.Type, mon.Target, mon.ComponentID = "pop3", "pop3", pop3, 1
+	mon.Validate()
+	if !mon.test(l) {
+		t.Errorf("pop3 check should have passed: %s", mon.lastFailReason)
+	}
+
+	mon.Password = "wrong"
+	if mon.test(l) || mon.lastFailReason != "POP3: -ERR invalid credentials" {
+		t.Errorf("unexpected fail reason: %s", mon.lastFailReason)
+	}
+
+	mon = &MailMonitor{Username: "monitor", Password: "secret", ExpectedGreeting: "Dovecot"}
+	mon.Name, mon.Type, mon.Target, mon.ComponentID = "imap", "imap", imap, 1
+	mon.Validate()
+	if mon.test(l) || !strings.HasPrefix(mon.lastFailReason, "Unexpected greeting: * OK fake IMAP ready") {
+		t.Errorf("unexpected fail reason: %s", mon.lastFailReason)
+	}
+
+	mon.ExpectedGreeting = "IMAP"
+	mon.Validate()
+	if !mon.test(l) {
+		t.Errorf("imap check should have passed: %s", mon.lastFailReason)
+	}
+}
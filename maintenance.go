@@ -0,0 +1,180 @@
+package cachet
+
+import (
+	"errors"
+	"strconv"
+	"time"
+)
+
+// Accepted formats for absolute maintenance windows (local time unless specified)
+var maintenanceTimeFormats = []string{
+	time.RFC3339,
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02T15:04",
+}
+
+// MaintenanceWindow is a locally declared maintenance period: either an absolute
+// range (start/end) or a recurring one (cron + duration in seconds)
+type MaintenanceWindow struct {
+	Name     string        `json:"name" yaml:"name" mapstructure:"name"`
+	Start    string        `json:"start" yaml:"start" mapstructure:"start"`
+	End      string        `json:"end" yaml:"end" mapstructure:"end"`
+	Cron     string        `json:"cron" yaml:"cron" mapstructure:"cron"`
+	Duration time.Duration `json:"duration" yaml:"duration" mapstructure:"duration"`
+
+	// Restricts a global window to these components (all components when empty)
+	Components []int `json:"components" yaml:"components" mapstructure:"components"`
+
+	start time.Time
+	end   time.Time
+	cron  *CronSchedule
+}
+
+func (w *MaintenanceWindow) Validate() []string {
+	errs := []string{}
+
+	if len(w.Cron) > 0 {
+		cron, err := ParseCron(w.Cron)
+		if err != nil {
+			errs = append(errs, "Maintenance window '"+w.describe()+"': "+err.Error())
+		}
+		w.cron = cron
+
+		if w.Duration < 1 {
+			errs = append(errs, "Maintenance window '"+w.describe()+"': 'duration' is required with 'cron'")
+		}
+
+		return errs
+	}
+
+	var err error
+	if w.start, err = parseMaintenanceTime(w.Start); err != nil {
+		errs = append(errs, "Maintenance window '"+w.describe()+"': invalid 'start': "+err.Error())
+	}
+	if w.end, err = parseMaintenanceTime(w.End); err != nil {
+		errs = append(errs, "Maintenance window '"+w.describe()+"': invalid 'end': "+err.Error())
+	}
+
+	if len(errs) == 0 && !w.end.After(w.start) {
+		errs = append(errs, "Maintenance window '"+w.describe()+"': 'end' must be after 'start'")
+	}
+
+	return errs
+}
+
+// Active tells if now falls into the window
+func (w *MaintenanceWindow) Active(now time.Time) bool {
+	if w.cron != nil {
+		// the first occurrence after (now - duration) is the one that could still be running
+		start := w.cron.Next(now.Add(-w.Duration * time.Second))
+		return !start.IsZero() && !start.After(now)
+	}
+
+	if w.start.IsZero() || w.end.IsZero() {
+		return false
+	}
+
+	return !now.Before(w.start) && now.Before(w.end)
+}
+
+// Covers tells if the window applies to the given component
+func (w *MaintenanceWindow) Covers(componentID int) bool {
+	if len(w.Components) == 0 {
+		return true
+	}
+
+	for _, id := range w.Components {
+		if id == componentID {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (w *MaintenanceWindow) describe() string {
+	if len(w.Name) > 0 {
+		return w.Name
+	}
+	if len(w.Cron) > 0 {
+		return w.Cron + " (" + strconv.Itoa(int(w.Duration)) + "s)"
+	}
+
+	return w.Start + " - " + w.End
+}
+
+func parseMaintenanceTime(value string) (time.Time, error) {
+	if len(value) == 0 {
+		return time.Time{}, errors.New("empty value")
+	}
+
+	for _, format := range maintenanceTimeFormats {
+		if t, err := time.ParseInLocation(format, value, time.Local); err == nil {
+			return t, nil
+		}
+	}
+
+	return time.Time{}, errors.New("'" + value + "' does not match any of the supported formats")
+}
+
+// inMaintenance looks for a local (global) window or a Cachet schedule covering the component
+func (cfg *CachetMonitor) inMaintenance(componentID int, now time.Time) (string, bool) {
+	for i := range cfg.Maintenance {
+		w := &cfg.Maintenance[i]
+		if w.Covers(componentID) && w.Active(now) {
+			return w.describe(), true
+		}
+	}
+
+	if !cfg.CachetSchedules || componentID == 0 {
+		return "", false
+	}
+
+	for _, schedule := range cfg.getSchedules() {
+		if schedule.Covers(componentID) && schedule.Active(now) {
+			return "Cachet schedule '" + schedule.Name + "'", true
+		}
+	}
+
+	return "", false
+}
+
+// getSchedules returns Cachet scheduled maintenances, refreshed at most every DefaultScheduleRefresh
+func (cfg *CachetMonitor) getSchedules() []Schedule {
+	cfg.schedulesMu.Lock()
+	if cfg.schedulesFetching || time.Since(cfg.schedulesFetched) < DefaultScheduleRefresh {
+		// up to date, or being refreshed by another monitor
+		defer cfg.schedulesMu.Unlock()
+		return cfg.schedules
+	}
+	cfg.schedulesFetching = true
+	cfg.schedulesMu.Unlock()
+
+	// fetched without the lock: the other monitors keep using the previous list
+	schedules, err := cfg.API.GetSchedules()
+
+	cfg.schedulesMu.Lock()
+	defer cfg.schedulesMu.Unlock()
+
+	// on failure keep the previous list and retry on the next refresh
+	if err == nil {
+		cfg.schedules = schedules
+	}
+	cfg.schedulesFetched = time.Now()
+	cfg.schedulesFetching = false
+
+	return cfg.schedules
+}
+
+// inMaintenance checks the monitor's own windows, then global ones and Cachet schedules
+func (mon *AbstractMonitor) inMaintenance(now time.Time) (string, bool) {
+	for i := range mon.Maintenance {
+		w := &mon.Maintenance[i]
+		if w.Active(now) {
+			return w.describe(), true
+		}
+	}
+
+	return mon.config.inMaintenance(mon.ComponentID, now)
+}
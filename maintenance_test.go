@@ -0,0 +1,66 @@
+package cachet
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestGetSchedules(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		page := r.URL.Query().Get("page")
+		fmt.Fprintf(w, `{"meta":{"pagination":{"current_page":%s,"total_pages":2}},"data":[{"id":%s,"status":1}]}`, page, page)
+	}))
+	defer server.Close()
+
+	cfg := &CachetMonitor{API: CachetAPI{URL: server.URL}}
+	schedules := cfg.getSchedules()
+	if len(schedules) != 2 || schedules[0].ID != 1 || schedules[1].ID != 2 {
+		t.Errorf("both pages should have been fetched, got %v", schedules)
+	}
+
+	// cached until the next refresh
+	server.Close()
+	if schedules := cfg.getSchedules(); len(schedules) != 2 {
+		t.Errorf("cached schedules should have been returned, got %v", schedules)
+	}
+}
+
+func TestTickMaintenance(t *testing.T) {
+	stub, api := startCachetStub(t)
+	mon := &scriptedMonitor{AbstractMonitor: *newAnalysedMonitor(t, api), failures: 100}
+	mon.Enabled, mon.stopC = true, make(chan bool)
+	mon.Maintenance = []MaintenanceWindow{{start: time.Now().Add(-time.Hour), end: time.Now().Add(time.Hour)}}
+
+	// failures during the window are recorded but not analysed
+	for i := 0; i < mon.HistorySize; i++ {
+		mon.tick(mon)
+	}
+	if len(stub.incidents) != 0 || len(stub.statuses) != 0 || !mon.inMaintenanceWindow {
+		t.Errorf("nothing should be written during maintenance (incidents: %d, statuses: %v)", len(stub.incidents), stub.statuses)
+	}
+
+	// re-evaluated once the window is over
+	mon.Maintenance[0].end = time.Now()
+	mon.tick(mon)
+	if mon.inMaintenanceWindow || mon.incident == nil || len(stub.incidents) != 1 {
+		t.Errorf("incident should have been opened after the window (incidents: %d)", len(stub.incidents))
+	}
+
+	// an incident opened before the window is resolved as soon as the history is clean
+	mon.failures = mon.calls
+	mon.Maintenance[0].end = time.Now().Add(time.Hour)
+	for i := 0; i < mon.HistorySize; i++ {
+		mon.tick(mon)
+	}
+	if mon.incident == nil {
+		t.Fatal("incident should be kept open during maintenance")
+	}
+	mon.Maintenance[0].end = time.Now()
+	mon.tick(mon)
+	if mon.incident != nil || len(stub.incidents) != 2 || stub.incidents[1].Status != 4 {
+		t.Errorf("incident should have been resolved right after the window (updates: %d)", len(stub.incidents))
+	}
+}
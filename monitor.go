@@ -1,10 +1,11 @@
 package cachet
 
 import (
+	"math/rand"
 	"sync"
 	"time"
 	"strconv"
-	"os/exec"
+	"strings"
 
 	"github.com/Sirupsen/logrus"
 )
@@ -13,6 +14,7 @@ const DefaultInterval = time.Second * 60
 const DefaultTimeout = time.Second
 const DefaultTimeFormat = "15:04:05 Jan 2 MST"
 const DefaultHistorySize = 10
+const DefaultScheduleRefresh = time.Second * 60
 
 type MonitorInterface interface {
 	ClockStart(*CachetMonitor, MonitorInterface, *sync.WaitGroup)
@@ -32,7 +34,7 @@ type AbstractMonitor struct {
 	Target string
 	Enabled bool
 
-	// (default)http / dns
+	// (default)http / dns / mock / heartbeat / exec / smtp / imap / pop3 / postgres / mysql / redis / grpc / websocket / http_scenario / udp / ntp
 	Type   string
 	Strict bool
 
@@ -40,6 +42,19 @@ type AbstractMonitor struct {
 	Timeout  time.Duration
 	Resync  int
 
+	// Cron expression used instead of the fixed interval
+	Schedule string
+	// Outside of these windows the monitor is not evaluated
+	ActiveHours []ActiveWindow `mapstructure:"active_hours"`
+	// Maximum random delay (seconds) before the first check
+	Jitter time.Duration
+	// Interval used until the history is clean again after a failure
+	FailureInterval time.Duration `mapstructure:"failure_interval"`
+
+	// A failed check is re-attempted up to Retries times (RetryDelay seconds apart) before being recorded
+	Retries    int
+	RetryDelay time.Duration `mapstructure:"retry_delay"`
+
 	MetricID    int `mapstructure:"metric_id"`
 	ComponentID int `mapstructure:"component_id"`
 
@@ -53,11 +68,20 @@ type AbstractMonitor struct {
 	// ShellHook stuff
 	ShellHookOnSuccess string	`mapstructure:"on_success"`
 	ShellHookOnFailure string	`mapstructure:"on_failure"`
+	ShellHookOnIncidentOpen string	`mapstructure:"on_incident_open"`
+	ShellHookOnIncidentResolve string	`mapstructure:"on_incident_resolve"`
+	ShellHookOnStatusChange string	`mapstructure:"on_status_change"`
+	// Seconds after which a hook is killed
+	HookTimeout time.Duration	`mapstructure:"hook_timeout"`
+
+	// Maintenance windows: probes keep running but no incident/status is changed
+	Maintenance []MaintenanceWindow
 
 	// Templating stuff
 	Template struct {
 		Investigating MessageTemplate
 		Fixed         MessageTemplate
+		Unstable      MessageTemplate
 	}
 
 	// Threshold = percentage / number of down incidents
@@ -72,16 +96,41 @@ type AbstractMonitor struct {
 	PartialThreshold      int `mapstructure:"threshold_partial"`
 	PartialThresholdCount int `mapstructure:"threshold_partial_count"`
 
+	// An open incident is resolved once the down percentage (count) is below these
+	ResolveThreshold      int `mapstructure:"threshold_resolve"`
+	ResolveThresholdCount int `mapstructure:"threshold_resolve_count"`
+	// Seconds an incident stays open at least
+	MinIncidentDuration time.Duration `mapstructure:"min_incident_duration"`
+
+	// Percentage of state changes in the history above which the monitor is flapping
+	FlapThreshold int `mapstructure:"flap_threshold"`
+	// Percentage of state changes below which the monitor is stable again
+	FlapThresholdLow int `mapstructure:"flap_threshold_low"`
+
 	// lag / average(lagHistory) * 100 = percentage above average lag
 	// PerformanceThreshold sets the % limit above which this monitor will trigger degraded-performance
 	// PerformanceThreshold float32
 
 	resyncMod	int
 	currentStatus	int
+	inMaintenanceWindow bool
+	notEvaluated bool
+	flapping bool
+	leaderTerm int
+	schedule *CronSchedule
 	history []bool
+	// component status of each sample of history (0 when up)
+	severities []int
 	// lagHistory     []float32
 	lastFailReason string
+	// set by test(): component status for a failed check (2 performance issues, 3 partial, 4/0 major)
+	severity int
+	// set by test() when the check could not tell (nothing is recorded)
+	unknown bool
 	incident       *Incident
+	incidentSince  time.Time
+	// locations seeing the failure (quorum mode)
+	failingLocations []Verdict
 	config         *CachetMonitor
 
 	// Closed when mon.Stop() is called
@@ -106,6 +155,51 @@ func (mon *AbstractMonitor) Validate() []string {
 		errs = append(errs, "Timeout greater than interval")
 	}
 
+	mon.schedule = nil
+	if len(mon.Schedule) > 0 {
+		schedule, err := ParseCron(mon.Schedule)
+		if err != nil {
+			errs = append(errs, "Invalid 'schedule': "+err.Error())
+		} else if schedule.Next(time.Now()).IsZero() {
+			// e.g. "0 0 31 2 *": the monitor would never be checked
+			errs = append(errs, "Invalid 'schedule': '"+mon.Schedule+"' never fires")
+		}
+		mon.schedule = schedule
+	}
+
+	for i := range mon.ActiveHours {
+		errs = append(errs, mon.ActiveHours[i].Validate()...)
+	}
+
+	if mon.Jitter < 0 {
+		mon.Jitter = 0
+	}
+
+	if mon.FailureInterval < 0 {
+		mon.FailureInterval = 0
+	}
+	if mon.FailureInterval > 0 && mon.Timeout > mon.FailureInterval {
+		errs = append(errs, "Timeout greater than failure interval")
+	}
+
+	if mon.Retries < 0 {
+		mon.Retries = 0
+	}
+	if mon.RetryDelay < 0 {
+		mon.RetryDelay = 0
+	}
+	if mon.Retries > 0 {
+		interval := mon.Interval
+		if mon.FailureInterval > 0 && mon.FailureInterval < interval {
+			interval = mon.FailureInterval
+		}
+
+		attempts := time.Duration(mon.Retries)
+		if (attempts+1)*mon.Timeout+attempts*mon.RetryDelay > interval {
+			errs = append(errs, "Retries (timeout and retry_delay included) do not fit within the interval")
+		}
+	}
+
 	if mon.ComponentID == 0 && mon.MetricID == 0 {
 		errs = append(errs, "component_id & metric_id are unset")
 	}
@@ -142,12 +236,42 @@ func (mon *AbstractMonitor) Validate() []string {
 		mon.Threshold = 100
 	}
 
+	if mon.ResolveThreshold < 0 {
+		mon.ResolveThreshold = 0
+	}
+	if mon.ResolveThresholdCount < 0 {
+		mon.ResolveThresholdCount = 0
+	}
+	if mon.MinIncidentDuration < 0 {
+		mon.MinIncidentDuration = 0
+	}
+
+	if mon.HookTimeout < 1 {
+		mon.HookTimeout = DefaultHookTimeout
+	}
+
+	if mon.FlapThreshold < 0 || mon.FlapThreshold > 100 {
+		errs = append(errs, "'flap_threshold' must be a percentage")
+	}
+	if mon.FlapThresholdLow <= 0 || mon.FlapThresholdLow > mon.FlapThreshold {
+		mon.FlapThresholdLow = mon.FlapThreshold / 2
+	}
+
+	for i := range mon.Maintenance {
+		errs = append(errs, mon.Maintenance[i].Validate()...)
+	}
+
+	mon.Template.Unstable.SetDefault(defaultUnstableTpl)
+
 	if err := mon.Template.Fixed.Compile(); err != nil {
 		errs = append(errs, "Could not compile \"fixed\" template: "+err.Error())
 	}
 	if err := mon.Template.Investigating.Compile(); err != nil {
 		errs = append(errs, "Could not compile \"investigating\" template: "+err.Error())
 	}
+	if err := mon.Template.Unstable.Compile(); err != nil {
+		errs = append(errs, "Could not compile \"unstable\" template: "+err.Error())
+	}
 
 	return errs
 }
@@ -171,12 +295,54 @@ func (mon *AbstractMonitor) Describe() []string {
 	if mon.Resync > 0 {
 		features = append(features, "Resyncs cycle: " + strconv.Itoa(mon.Resync))
 	}
+	if len(mon.Schedule) > 0 {
+		features = append(features, "Schedule: "+mon.Schedule)
+	}
+	if len(mon.ActiveHours) > 0 {
+		windows := []string{}
+		for i := range mon.ActiveHours {
+			windows = append(windows, mon.ActiveHours[i].describe())
+		}
+		features = append(features, "Active hours: "+strings.Join(windows, ", "))
+	}
+	if mon.Jitter > 0 {
+		features = append(features, "Startup jitter: "+strconv.Itoa(int(mon.Jitter))+"s")
+	}
+	if mon.FailureInterval > 0 {
+		features = append(features, "Failure interval: "+strconv.Itoa(int(mon.FailureInterval))+"s")
+	}
+	if mon.Retries > 0 {
+		features = append(features, "Retries: "+strconv.Itoa(mon.Retries)+" (delay: "+strconv.Itoa(int(mon.RetryDelay))+"s)")
+	}
 	if len(mon.ShellHookOnSuccess) > 0 {
 		features = append(features, "Has a 'on_success' shellhook")
 	}
 	if len(mon.ShellHookOnFailure) > 0 {
 		features = append(features, "Has a 'on_failure' shellhook")
 	}
+	if len(mon.ShellHookOnIncidentOpen) > 0 {
+		features = append(features, "Has a 'on_incident_open' shellhook")
+	}
+	if len(mon.ShellHookOnIncidentResolve) > 0 {
+		features = append(features, "Has a 'on_incident_resolve' shellhook")
+	}
+	if len(mon.ShellHookOnStatusChange) > 0 {
+		features = append(features, "Has a 'on_status_change' shellhook")
+	}
+	if len(mon.Maintenance) > 0 {
+		features = append(features, "Maintenance windows: "+strconv.Itoa(len(mon.Maintenance)))
+	}
+	if mon.ResolveThresholdCount > 0 {
+		features = append(features, "Resolve threshold (count): "+strconv.Itoa(mon.ResolveThresholdCount))
+	} else if mon.ResolveThreshold > 0 {
+		features = append(features, "Resolve threshold (percent): "+strconv.Itoa(mon.ResolveThreshold))
+	}
+	if mon.MinIncidentDuration > 0 {
+		features = append(features, "Minimum incident duration: "+strconv.Itoa(int(mon.MinIncidentDuration))+"s")
+	}
+	if mon.FlapThreshold > 0 {
+		features = append(features, "Flap detection (percent): "+strconv.Itoa(mon.FlapThreshold)+" / "+strconv.Itoa(mon.FlapThresholdLow))
+	}
 
 	return features
 }
@@ -218,6 +384,9 @@ func (mon *AbstractMonitor) ReloadCachetData() {
 
 	if mon.incident != nil {
 		logrus.Infof("Current incident ID: %v", mon.incident.ID)
+		if mon.incidentSince.IsZero() {
+			mon.incidentSince = time.Now()
+		}
 	} else {
 		logrus.Infof("No current incident")
 	}
@@ -235,46 +404,99 @@ func (mon *AbstractMonitor) Init(cfg *CachetMonitor) bool {
 		IsValid = false
 	}
 
-	mon.history = append(mon.history, mon.isUp())
+	mon.record(mon.isUp(), mon.currentStatus)
 
 	return IsValid
 }
 
-func (mon *AbstractMonitor) triggerShellHook(l *logrus.Entry, hooktype string, hook string, data string) {
-	if len(hook) == 0 {
-		return
-	}
-	l.Infof("Sending '%s' shellhook", hooktype)
-	l.Debugf("Data: %s", data)
-
-	out, err := exec.Command(hook, mon.Name, strconv.Itoa(mon.ComponentID), mon.Target, hooktype, data).Output()
-	if err != nil {
-	    l.Warnf("Error when processing shellhook '%s': %s", hooktype, err)
-	    l.Warnf("Command output: %s", out)
-	}
-}
-
 func (mon *AbstractMonitor) ClockStart(cfg *CachetMonitor, iface MonitorInterface, wg *sync.WaitGroup) {
 	wg.Add(1)
 
 	mon.stopC = make(chan bool)
 
+	// spread monitors sharing the same interval
+	if mon.Jitter > 0 {
+		delay := mon.startDelay(rand.New(rand.NewSource(time.Now().UnixNano())))
+		logrus.WithFields(logrus.Fields{ "monitor": mon.Name }).Debugf("Delaying first check by %v", delay)
+
+		select {
+		case <-time.After(delay):
+		case <-mon.stopC:
+			wg.Done()
+			return
+		}
+	}
+
 	if cfg.Immediate {
 		mon.tick(iface)
 	}
 
-	ticker := time.NewTicker(mon.Interval * time.Second)
+	next := mon.nextTick(time.Now())
 	for {
+		if next.IsZero() {
+			logrus.WithFields(logrus.Fields{ "monitor": mon.Name }).Warnf("Schedule has no upcoming occurrence, monitor stopped")
+			<-mon.stopC
+			wg.Done()
+			return
+		}
+
+		timer := time.NewTimer(time.Until(next))
+
 		select {
-		case <-ticker.C:
+		case <-timer.C:
 			mon.tick(iface)
+
+			// skip the occurrences missed while ticking
+			now := time.Now()
+			next = mon.nextTick(next)
+			for !next.IsZero() && next.Before(now) {
+				next = mon.nextTick(next)
+			}
 		case <-mon.stopC:
+			timer.Stop()
 			wg.Done()
 			return
 		}
 	}
 }
 
+// startDelay draws the random delay of the first check, within [0, Jitter)
+func (mon *AbstractMonitor) startDelay(r *rand.Rand) time.Duration {
+	if mon.Jitter < 1 {
+		return 0
+	}
+
+	return time.Duration(r.Int63n(int64(mon.Jitter * time.Second)))
+}
+
+// nextTick returns when the check following the one planned at last should run
+func (mon *AbstractMonitor) nextTick(last time.Time) time.Time {
+	if mon.FailureInterval > 0 && mon.isFailing() {
+		return last.Add(mon.FailureInterval * time.Second)
+	}
+
+	if mon.schedule != nil {
+		return mon.schedule.Next(last)
+	}
+
+	return last.Add(mon.Interval * time.Second)
+}
+
+// isActive tells if the monitor has to be evaluated now (see ActiveHours)
+func (mon *AbstractMonitor) isActive(now time.Time) bool {
+	if len(mon.ActiveHours) == 0 {
+		return true
+	}
+
+	for i := range mon.ActiveHours {
+		if mon.ActiveHours[i].Active(now) {
+			return true
+		}
+	}
+
+	return false
+}
+
 func (mon *AbstractMonitor) ClockStop() {
 	select {
 	case <-mon.stopC:
@@ -284,10 +506,58 @@ func (mon *AbstractMonitor) ClockStop() {
 	}
 }
 
+// isFailing tells if a failed check is still part of the history window
+func (mon *AbstractMonitor) isFailing() bool {
+	for _, wasUp := range mon.history {
+		if ! wasUp {
+			return true
+		}
+	}
+
+	return false
+}
+
+// record appends a sample to the history, dropping the oldest one when it is full
+func (mon *AbstractMonitor) record(isUp bool, severity int) {
+	if isUp {
+		severity = 0
+	} else if severity < 2 || severity > 4 {
+		severity = 4
+	}
+
+	if mon.HistorySize > 0 && len(mon.history) >= mon.HistorySize {
+		mon.history = mon.history[len(mon.history)-(mon.HistorySize-1):]
+	}
+	if mon.HistorySize > 0 && len(mon.severities) >= mon.HistorySize {
+		mon.severities = mon.severities[len(mon.severities)-(mon.HistorySize-1):]
+	}
+	mon.history = append(mon.history, isUp)
+	mon.severities = append(mon.severities, severity)
+}
+
+// failureSeverity is the worst component status among the failed samples of the history
+func (mon *AbstractMonitor) failureSeverity() int {
+	worst := 0
+	for _, severity := range mon.severities {
+		if severity > worst {
+			worst = severity
+		}
+	}
+	if worst == 0 && mon.isFailing() {
+		return 4
+	}
+
+	return worst
+}
+
 func (mon *AbstractMonitor) isUp() bool {
 	return (mon.currentStatus == 1)
 }
 
+func (mon *AbstractMonitor) isDegraded() bool {
+	return (mon.currentStatus == 2)
+}
+
 func (mon *AbstractMonitor) isPartial() bool {
 	return (mon.currentStatus == 3)
 }
@@ -306,21 +576,89 @@ func (mon *AbstractMonitor) tick(iface MonitorInterface) {
 		return
 	}
 
+	if ! mon.isActive(time.Now()) {
+		if ! mon.notEvaluated {
+			l.Infof("monitor not evaluated (outside of active hours)")
+			mon.notEvaluated = true
+		}
+		return
+	}
+	if mon.notEvaluated {
+		l.Infof("monitor is back in its active hours")
+		mon.notEvaluated = false
+	}
+
 	reqStart := getMs()
 	isUp := true
+	mon.severity, mon.unknown = 0, false
 	isUp = iface.test(l)
 	lag := getMs() - reqStart
 
+	// transient failures are re-attempted before being recorded
+	for attempt := 1; ! isUp && attempt <= mon.Retries; attempt++ {
+		l.Infof("Check failed (%s), retrying (%d/%d)", mon.lastFailReason, attempt, mon.Retries)
+
+		select {
+		case <-time.After(mon.RetryDelay * time.Second):
+		case <-mon.stopC:
+			return
+		}
+
+		reqStart = getMs()
+		mon.severity, mon.unknown = 0, false
+		isUp = iface.test(l)
+		lag = getMs() - reqStart
+	}
+
+	if mon.unknown {
+		l.Infof("Check result unknown, not recorded: %s", mon.lastFailReason)
+		return
+	}
+	failing := mon.isFailing()
+
 	if len(mon.history) == mon.HistorySize-1 {
 		l.Debugf("monitor %v is now fully operational", mon.Name)
 	}
 
-	if len(mon.history) >= mon.HistorySize {
-		mon.history = mon.history[len(mon.history)-(mon.HistorySize-1):]
+	mon.record(isUp, mon.severity)
+
+	if mon.FailureInterval > 0 && failing != mon.isFailing() {
+		if failing {
+			l.Infof("History is clean, back to the normal interval")
+		} else {
+			l.Infof("Check failed, switching to the failure interval (%ds)", mon.FailureInterval)
+		}
 	}
-	mon.history = append(mon.history, isUp)
 
-	mon.AnalyseData(l)
+	// HA: standby replicas probe but leave Cachet to the leader
+	writer, term := mon.config.isWriter()
+	if writer && term != mon.leaderTerm {
+		// the state may have been changed by the previous leader
+		l.Infof("Leadership acquired, reloading component's data")
+		mon.leaderTerm = term
+		mon.ReloadCachetData()
+	}
+
+	if ! writer {
+		l.Debugf("Standby replica, not writing to Cachet")
+	} else if window, ok := mon.inMaintenance(time.Now()); ok {
+		if ! mon.inMaintenanceWindow {
+			l.Infof("Entering maintenance window: %s", window)
+			mon.inMaintenanceWindow = true
+		}
+		l.Debugf("In maintenance (%s), skipping incident and status evaluation", window)
+	} else {
+		if mon.inMaintenanceWindow {
+			// the whole history is re-evaluated: an incident opened before the window can be resolved right away
+			l.Infof("Maintenance window is over, re-evaluating")
+			mon.inMaintenanceWindow = false
+			mon.ReloadCachetData()
+		}
+
+		previousStatus := mon.currentStatus
+		mon.AnalyseData(l)
+		mon.triggerStatusHook(l, previousStatus)
+	}
 
 	// Will trigger shellhook 'on_failure' as this isn't done in implementations
 	if ! isUp {
@@ -328,10 +666,12 @@ func (mon *AbstractMonitor) tick(iface MonitorInterface) {
 	}
 
 	// report lag
-	if mon.MetricID > 0 {
-		go mon.config.API.SendMetric(l, mon.MetricID, lag)
+	if writer {
+		if mon.MetricID > 0 {
+			go mon.config.API.SendMetric(l, mon.MetricID, lag)
+		}
+		go mon.config.API.SendMetrics(l, "response time", mon.Metrics.ResponseTime, float64(lag))
 	}
-	go mon.config.API.SendMetrics(l, "response time", mon.Metrics.ResponseTime, lag)
 
 	if(mon.Resync > 0) {
 		mon.resyncMod = (mon.resyncMod+1) % mon.Resync
@@ -344,7 +684,6 @@ func (mon *AbstractMonitor) tick(iface MonitorInterface) {
 	}
 }
 
-// TODO: test
 // AnalyseData decides if the monitor is statistically up or down and creates / resolves an incident
 func (mon *AbstractMonitor) AnalyseData(l *logrus.Entry) {
 	// look at the past few incidents
@@ -367,6 +706,10 @@ func (mon *AbstractMonitor) AnalyseData(l *logrus.Entry) {
 		return
 	}
 
+	if mon.analyseFlapping(l) {
+		return
+	}
+
 	triggered := false
 	criticalTriggered := false
 	partialTriggered := false
@@ -405,51 +748,62 @@ func (mon *AbstractMonitor) AnalyseData(l *logrus.Entry) {
 		l.Debugf("Is critically Triggered: %t", criticalTriggered)
 		l.Debugf("Is partially Triggered: %t", partialTriggered)
 		l.Debugf("Monitor's current incident: %v", mon.incident)
+	}
 
-		if triggered || criticalTriggered || partialTriggered {
-			// Process metric
-			go mon.config.API.SendMetrics(l, "incident count", mon.Metrics.IncidentCount, 1)
+	// the failures were at worst warnings
+	if (triggered || criticalTriggered) && mon.failureSeverity() == 3 {
+		l.Debugf("Failures are at worst warnings, downgrading to partial outage")
+		triggered, criticalTriggered, partialTriggered = false, false, true
+	}
 
-			if mon.incident == nil {
-				// create incident
-				mon.currentStatus = 2
-				tplData := getTemplateData(mon)
-				tplData["FailReason"] = mon.lastFailReason
+	// the status is changed only when enough locations agree
+	if mon.config.Quorum != nil {
+		triggered, criticalTriggered, partialTriggered = mon.quorumVerdict(l, triggered, criticalTriggered, partialTriggered)
+	}
 
-				subject, message := mon.Template.Investigating.Exec(tplData)
-				incidentForceComponentStatus := 4
-				if partialTriggered {
-					incidentForceComponentStatus = 3
-				}
-				mon.incident = &Incident{
-					Name:        subject,
-					ComponentID: mon.ComponentID,
-					Message:     message,
-					Notify:      true,
-					ComponentStatus: incidentForceComponentStatus,
-				}
+	// the failures were all slow responses
+	degradedTriggered := false
+	if (triggered || criticalTriggered || partialTriggered) && mon.failureSeverity() == 2 {
+		l.Debugf("Failures are all slow responses, downgrading to performance issues")
+		triggered, criticalTriggered, partialTriggered, degradedTriggered = false, false, false, true
+	}
 
-				// is down, create an incident
-				l.Warnf("creating incident. Monitor is down: %v", mon.lastFailReason)
-				// set investigating status
-				mon.incident.SetInvestigating()
-				// create incident 
-				if err := mon.incident.Send(mon.config); err != nil {
-					l.Printf("Error sending incident: %v", err)
-				}
+	if triggered || criticalTriggered || partialTriggered || degradedTriggered {
+		// Process metric
+		go mon.config.API.SendMetrics(l, "incident count", mon.Metrics.IncidentCount, 1)
+
+		opened := false
+		if mon.incident == nil {
+			incidentForceComponentStatus := 4
+			if partialTriggered {
+				incidentForceComponentStatus = 3
 			}
-			if triggered || criticalTriggered {
-				if (! mon.isCritical()) {
-					mon.config.API.SetComponentStatus(mon, 4)
-				}
+			if degradedTriggered {
+				incidentForceComponentStatus = 2
 			}
-			if partialTriggered {
-				if (! mon.isPartial()) {
-					mon.config.API.SetComponentStatus(mon, 3)
-				}
+
+			// is down, create an incident
+			l.Warnf("creating incident. Monitor is down: %v", mon.lastFailReason)
+			mon.openIncident(l, &mon.Template.Investigating, getTemplateData(mon), incidentForceComponentStatus)
+			opened = true
+		}
+		if triggered || criticalTriggered {
+			if (! mon.isCritical()) {
+				mon.config.API.SetComponentStatus(mon, 4)
 			}
-			return
 		}
+		if partialTriggered {
+			if (! mon.isPartial()) {
+				mon.config.API.SetComponentStatus(mon, 3)
+			}
+		}
+		if degradedTriggered {
+			// openIncident leaves currentStatus to 2 while Cachet has the incident's status
+			if (opened || ! mon.isDegraded()) {
+				mon.config.API.SetComponentStatus(mon, 2)
+			}
+		}
+		return
 	}
 
 	// we are up to normal
@@ -467,6 +821,16 @@ func (mon *AbstractMonitor) AnalyseData(l *logrus.Entry) {
 		return
 	}
 
+	// hysteresis: the incident stays open until the monitor is clearly back
+	if ! mon.isResolvable(numDown, t) {
+		l.Printf("monitor recovering, incident kept open (down count=%d, down percentage=%.2f%%, resolve threshold=%d%% / count %d)", numDown, t, mon.ResolveThreshold, mon.ResolveThresholdCount)
+		return
+	}
+	if mon.MinIncidentDuration > 0 && time.Since(mon.incidentSince) < mon.MinIncidentDuration * time.Second {
+		l.Printf("monitor recovering, incident kept open (opened %v ago, minimum duration %ds)", time.Since(mon.incidentSince), mon.MinIncidentDuration)
+		return
+	}
+
 	// was down, created an incident, its now ok, make it resolved.
 	l.Infof("Resolving incident %d", mon.incident.ID)
 
@@ -481,8 +845,49 @@ func (mon *AbstractMonitor) AnalyseData(l *logrus.Entry) {
 	if err := mon.incident.Send(mon.config); err != nil {
 		l.Warnf("Error updating sending incident: %v", err)
 	}
+	mon.triggerShellHook(l, "on_incident_resolve", mon.ShellHookOnIncidentResolve, "")
 
 	mon.lastFailReason = ""
 	mon.incident = nil
+	mon.incidentSince = time.Time{}
 	mon.currentStatus = 1
 }
+
+// openIncident creates an incident from the given template
+func (mon *AbstractMonitor) openIncident(l *logrus.Entry, tpl *MessageTemplate, tplData map[string]interface{}, componentStatus int) {
+	mon.currentStatus = 2
+	tplData["FailReason"] = mon.lastFailReason
+	if locations := mon.describeFailingLocations(); len(locations) > 0 {
+		tplData["FailReason"] = strings.TrimSpace(mon.lastFailReason + "\n\n" + locations)
+	}
+
+	subject, message := tpl.Exec(tplData)
+	mon.incident = &Incident{
+		Name:        subject,
+		ComponentID: mon.ComponentID,
+		Message:     message,
+		Notify:      true,
+		ComponentStatus: componentStatus,
+	}
+	mon.incidentSince = time.Now()
+
+	// set investigating status
+	mon.incident.SetInvestigating()
+	// create incident
+	if err := mon.incident.Send(mon.config); err != nil {
+		l.Printf("Error sending incident: %v", err)
+	}
+	mon.triggerShellHook(l, "on_incident_open", mon.ShellHookOnIncidentOpen, "")
+}
+
+// isResolvable tells if the down percentage (count) went below the resolve threshold
+func (mon *AbstractMonitor) isResolvable(numDown int, t float32) bool {
+	if mon.ResolveThresholdCount > 0 && numDown >= mon.ResolveThresholdCount {
+		return false
+	}
+	if mon.ResolveThreshold > 0 && int(t) >= mon.ResolveThreshold {
+		return false
+	}
+
+	return true
+}
@@ -1,7 +1,455 @@
 package cachet
 
 import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"time"
+
+	"github.com/Sirupsen/logrus"
 )
 
-func TestAnalyseData(t *testing.T) {}
+// cachetStub is a fake Cachet API recording the component statuses and incidents it receives
+type cachetStub struct {
+	mu        sync.Mutex
+	statuses  []int
+	incidents []Incident
+	// incident count data points
+	incidentCount int
+	// an incident is open (created and not fixed yet)
+	open bool
+}
+
+func startCachetStub(t *testing.T) (*cachetStub, CachetAPI) {
+	stub := &cachetStub{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		stub.mu.Lock()
+		defer stub.mu.Unlock()
+
+		switch {
+		case r.Method == "PUT" && strings.HasPrefix(r.URL.Path, "/components/"):
+			var body struct {
+				Status int `json:"status"`
+			}
+			json.NewDecoder(r.Body).Decode(&body)
+			stub.statuses = append(stub.statuses, body.Status)
+		case r.Method == "GET" && strings.HasPrefix(r.URL.Path, "/components/"):
+			status := 1
+			if len(stub.statuses) > 0 {
+				status = stub.statuses[len(stub.statuses)-1]
+			}
+			fmt.Fprintf(w, `{"data":{"id":1,"status":%d,"enabled":true}}`, status)
+			return
+		case r.Method == "GET" && r.URL.Path == "/incidents":
+			if stub.open {
+				w.Write([]byte(`{"data":[{"id":1,"status":1}]}`))
+			} else {
+				w.Write([]byte(`{"data":[]}`))
+			}
+			return
+		case r.Method == "POST" && r.URL.Path == "/metrics/7/points":
+			stub.incidentCount++
+		case strings.HasPrefix(r.URL.Path, "/incidents"):
+			var incident Incident
+			json.NewDecoder(r.Body).Decode(&incident)
+			stub.incidents = append(stub.incidents, incident)
+			stub.open = incident.Status != 4
+		}
+		w.Write([]byte(`{"data":{"id":1,"status":1}}`))
+	}))
+	t.Cleanup(server.Close)
+
+	return stub, CachetAPI{URL: server.URL}
+}
+
+func (stub *cachetStub) lastStatus() int {
+	stub.mu.Lock()
+	defer stub.mu.Unlock()
+
+	if len(stub.statuses) == 0 {
+		return 0
+	}
+	return stub.statuses[len(stub.statuses)-1]
+}
+
+// newAnalysedMonitor returns an operational monitor reporting to the given API
+func newAnalysedMonitor(t *testing.T, api CachetAPI) *AbstractMonitor {
+	mon := &AbstractMonitor{Name: "api", Interval: 60, Timeout: 10, ComponentID: 1, HistorySize: 4, ThresholdCount: 2}
+	if errs := mon.Validate(); len(errs) > 0 {
+		t.Fatalf("invalid monitor: %v", errs)
+	}
+	mon.config = &CachetMonitor{API: api, DateFormat: DefaultTimeFormat}
+	mon.currentStatus = 1
+
+	return mon
+}
+
+func TestAnalyseData(t *testing.T) {
+	// samples: 0 up, otherwise the severity of the failure
+	for _, tc := range []struct {
+		name      string
+		setup     func(mon *AbstractMonitor)
+		samples   []int
+		incidents int
+		status    int
+		open      bool
+		flapping  bool
+	}{
+		{"history not saturated", nil, []int{4, 4}, 0, 1, false, false},
+		{"below threshold", nil, []int{0, 0, 4, 0}, 0, 1, false, false},
+		{"threshold reached", nil, []int{0, 4, 4, 0}, 1, 4, true, false},
+		{"recovered", nil, []int{4, 4, 0, 0, 0, 0}, 2, 1, false, false},
+		{"recovering", func(mon *AbstractMonitor) { mon.ResolveThresholdCount = 1 }, []int{4, 4, 0, 0, 0}, 1, 4, true, false},
+		{"minimum incident duration", func(mon *AbstractMonitor) { mon.MinIncidentDuration = 3600 }, []int{4, 4, 0, 0, 0, 0}, 1, 4, true, false},
+		{"flapping", func(mon *AbstractMonitor) { mon.FlapThreshold = 50 }, []int{0, 4, 0, 4, 0, 4, 0, 4}, 1, 3, true, true},
+		{"flapping settled", func(mon *AbstractMonitor) { mon.FlapThreshold = 50 }, []int{0, 4, 0, 4, 0, 0, 0, 0}, 2, 1, false, false},
+	} {
+		stub, api := startCachetStub(t)
+		mon := newAnalysedMonitor(t, api)
+		if tc.setup != nil {
+			tc.setup(mon)
+			mon.Validate()
+		}
+
+		l := logrus.WithFields(logrus.Fields{})
+		for _, sample := range tc.samples {
+			mon.record(sample == 0, sample)
+			mon.AnalyseData(l)
+		}
+
+		stub.mu.Lock()
+		incidents := stub.incidents
+		stub.mu.Unlock()
+		if len(incidents) != tc.incidents {
+			t.Errorf("%s: expected %d incident updates, got %d", tc.name, tc.incidents, len(incidents))
+		}
+		if mon.currentStatus != tc.status {
+			t.Errorf("%s: expected component status %d, got %d", tc.name, tc.status, mon.currentStatus)
+		}
+		if (mon.incident != nil) != tc.open {
+			t.Errorf("%s: incident should be open: %t", tc.name, tc.open)
+		}
+		if mon.flapping != tc.flapping {
+			t.Errorf("%s: monitor should be flapping: %t", tc.name, tc.flapping)
+		}
+		if tc.flapping && !strings.Contains(incidents[0].Name, "is unstable") {
+			t.Errorf("%s: expected an unstable incident, got %q", tc.name, incidents[0].Name)
+		}
+	}
+}
+
+func TestMinIncidentDuration(t *testing.T) {
+	stub, api := startCachetStub(t)
+	mon := newAnalysedMonitor(t, api)
+	mon.MinIncidentDuration = 60
+
+	l := logrus.WithFields(logrus.Fields{})
+	for _, sample := range []int{4, 4, 0, 0, 0, 0} {
+		mon.record(sample == 0, sample)
+		mon.AnalyseData(l)
+	}
+	if mon.incident == nil {
+		t.Fatal("incident younger than the minimum duration should be kept open")
+	}
+
+	mon.incidentSince = time.Now().Add(-61 * time.Second)
+	mon.record(true, 0)
+	mon.AnalyseData(l)
+	if mon.incident != nil || mon.currentStatus != 1 {
+		t.Errorf("incident older than the minimum duration should be resolved (status %d)", mon.currentStatus)
+	}
+
+	stub.mu.Lock()
+	defer stub.mu.Unlock()
+	if len(stub.incidents) != 2 || stub.incidents[1].Status != 4 {
+		t.Errorf("expected the incident to be created then fixed, got %v", stub.incidents)
+	}
+}
+
+func TestIncidentCountMetric(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		setup   func(mon *AbstractMonitor)
+		samples []int
+	}{
+		{"down", nil, []int{0, 0, 4, 4}},
+		{"flapping", func(mon *AbstractMonitor) { mon.FlapThreshold = 50 }, []int{0, 4, 0, 4}},
+	} {
+		stub, api := startCachetStub(t)
+		mon := newAnalysedMonitor(t, api)
+		mon.Metrics.IncidentCount = []int{7}
+		if tc.setup != nil {
+			tc.setup(mon)
+			mon.Validate()
+		}
+
+		l := logrus.WithFields(logrus.Fields{})
+		for _, sample := range tc.samples {
+			mon.record(sample == 0, sample)
+			mon.AnalyseData(l)
+		}
+		if mon.incident == nil {
+			t.Fatalf("%s: an incident should be open", tc.name)
+		}
+
+		// metrics are sent in the background
+		count := 0
+		for deadline := time.Now().Add(2 * time.Second); count == 0 && time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+			stub.mu.Lock()
+			count = stub.incidentCount
+			stub.mu.Unlock()
+		}
+		if count != 1 {
+			t.Errorf("%s: expected a single incident count data point, got %d", tc.name, count)
+		}
+	}
+}
+
+// scriptedMonitor fails its first checks, then passes
+type scriptedMonitor struct {
+	AbstractMonitor
+	failures int
+	calls    int
+}
+
+func (mon *scriptedMonitor) test(l *logrus.Entry) bool {
+	mon.calls++
+	if mon.calls <= mon.failures {
+		mon.lastFailReason = "scripted failure"
+		return false
+	}
+
+	return true
+}
+
+func TestTickRetries(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		retries  int
+		failures int
+		calls    int
+		up       bool
+	}{
+		{"no retry", 0, 1, 1, false},
+		{"passes on retry", 2, 2, 3, true},
+		{"retries exhausted", 1, 5, 2, false},
+	} {
+		_, api := startCachetStub(t)
+		mon := &scriptedMonitor{AbstractMonitor: *newAnalysedMonitor(t, api), failures: tc.failures}
+		mon.Enabled, mon.Retries, mon.stopC = true, tc.retries, make(chan bool)
+
+		mon.tick(mon)
+		if mon.calls != tc.calls {
+			t.Errorf("%s: expected %d checks, got %d", tc.name, tc.calls, mon.calls)
+		}
+		if len(mon.history) != 1 || mon.history[0] != tc.up {
+			t.Errorf("%s: expected a single %t sample, got %v", tc.name, tc.up, mon.history)
+		}
+	}
+
+	// stopped while waiting for a retry: nothing is recorded
+	_, api := startCachetStub(t)
+	mon := &scriptedMonitor{AbstractMonitor: *newAnalysedMonitor(t, api), failures: 1}
+	mon.Enabled, mon.Retries, mon.RetryDelay, mon.stopC = true, 1, 60, make(chan bool)
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		mon.ClockStop()
+	}()
+
+	done := make(chan bool)
+	go func() {
+		mon.tick(mon)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("tick should have returned once stopped")
+	}
+	if mon.calls != 1 || len(mon.history) != 0 {
+		t.Errorf("stopped retry should not be recorded (checks: %d, history: %v)", mon.calls, mon.history)
+	}
+}
+
+func TestFailureInterval(t *testing.T) {
+	_, api := startCachetStub(t)
+	mon := &scriptedMonitor{AbstractMonitor: *newAnalysedMonitor(t, api), failures: 1}
+	mon.Enabled, mon.FailureInterval, mon.stopC = true, 10, make(chan bool)
+
+	last := time.Now()
+	if next := mon.nextTick(last); next.Sub(last) != 60*time.Second {
+		t.Errorf("healthy monitor should use the interval, got %v", next.Sub(last))
+	}
+
+	mon.tick(mon)
+	if next := mon.nextTick(last); next.Sub(last) != 10*time.Second {
+		t.Errorf("failing monitor should use the failure interval, got %v", next.Sub(last))
+	}
+
+	// the failure leaves the history window
+	for i := 0; i < mon.HistorySize; i++ {
+		mon.tick(mon)
+	}
+	if next := mon.nextTick(last); next.Sub(last) != 60*time.Second {
+		t.Errorf("recovered monitor should be back to the interval, got %v", next.Sub(last))
+	}
+}
+
+func TestScheduleValidation(t *testing.T) {
+	for _, tc := range []struct {
+		schedule string
+		valid    bool
+	}{
+		{"*/5 * * * *", true},
+		{"0 0 29 2 *", true},
+		{"0 0 31 2 *", false},
+		{"0 0 * *", false},
+	} {
+		mon := &AbstractMonitor{Name: "api", Interval: 60, Timeout: 10, ComponentID: 1, Schedule: tc.schedule}
+		if errs := mon.Validate(); (len(errs) == 0) != tc.valid {
+			t.Errorf("%s: expected valid=%t, got %v", tc.schedule, tc.valid, errs)
+		}
+	}
+}
+
+func TestClockStart(t *testing.T) {
+	_, api := startCachetStub(t)
+	mon := &scriptedMonitor{AbstractMonitor: *newAnalysedMonitor(t, api)}
+	mon.Enabled, mon.Interval = true, 1
+
+	// immediate check, then one per interval
+	var wg sync.WaitGroup
+	go mon.ClockStart(&CachetMonitor{Immediate: true}, mon, &wg)
+	time.Sleep(1500 * time.Millisecond)
+	mon.ClockStop()
+	wg.Wait()
+	if mon.calls != 2 {
+		t.Errorf("expected 2 checks within 1.5s, got %d", mon.calls)
+	}
+
+	// a schedule without occurrence never ticks
+	mon = &scriptedMonitor{AbstractMonitor: *newAnalysedMonitor(t, api)}
+	mon.Enabled = true
+	mon.schedule, _ = ParseCron("0 0 31 2 *")
+	go mon.ClockStart(&CachetMonitor{}, mon, &wg)
+	time.Sleep(100 * time.Millisecond)
+	mon.ClockStop()
+	wg.Wait()
+	if mon.calls != 0 {
+		t.Errorf("schedule without occurrence should not be checked, got %d checks", mon.calls)
+	}
+}
+
+func TestStartDelay(t *testing.T) {
+	mon := &AbstractMonitor{}
+	r := rand.New(rand.NewSource(1))
+	if delay := mon.startDelay(r); delay != 0 {
+		t.Errorf("no jitter should not delay, got %v", delay)
+	}
+
+	mon.Jitter = 2
+	for i := 0; i < 1000; i++ {
+		if delay := mon.startDelay(r); delay < 0 || delay >= 2*time.Second {
+			t.Fatalf("delay %v out of [0, 2s)", delay)
+		}
+	}
+
+	// stopped while delayed: no check at all, even immediate
+	_, api := startCachetStub(t)
+	scripted := &scriptedMonitor{AbstractMonitor: *newAnalysedMonitor(t, api)}
+	scripted.Enabled, scripted.Jitter = true, 3600
+
+	var wg sync.WaitGroup
+	go scripted.ClockStart(&CachetMonitor{Immediate: true}, scripted, &wg)
+	time.Sleep(100 * time.Millisecond)
+	scripted.ClockStop()
+	wg.Wait()
+	if scripted.calls != 0 {
+		t.Errorf("monitor stopped during its jitter should not be checked, got %d checks", scripted.calls)
+	}
+}
+
+func TestTickActiveHours(t *testing.T) {
+	stub, api := startCachetStub(t)
+	mon := &scriptedMonitor{AbstractMonitor: *newAnalysedMonitor(t, api), failures: 10}
+	mon.Enabled, mon.stopC = true, make(chan bool)
+
+	// only active tomorrow
+	tomorrow := strconv.Itoa(int(time.Now().AddDate(0, 0, 1).Weekday()))
+	mon.ActiveHours = []ActiveWindow{{Days: tomorrow, From: "00:00", To: "23:59"}}
+	if errs := mon.ActiveHours[0].Validate(); len(errs) > 0 {
+		t.Fatalf("unexpected validation errors: %v", errs)
+	}
+
+	for i := 0; i < 3; i++ {
+		mon.tick(mon)
+	}
+	if mon.calls != 0 || len(mon.history) != 0 || !mon.notEvaluated {
+		t.Errorf("inactive monitor should not be checked (checks: %d, history: %v, not evaluated: %t)", mon.calls, mon.history, mon.notEvaluated)
+	}
+	if stub.lastStatus() != 0 {
+		t.Errorf("inactive monitor should not update the component, got status %d", stub.lastStatus())
+	}
+
+	// back in its active hours
+	mon.ActiveHours = nil
+	mon.tick(mon)
+	if mon.calls != 1 || len(mon.history) != 1 || mon.notEvaluated {
+		t.Errorf("active monitor should be checked (checks: %d, history: %v, not evaluated: %t)", mon.calls, mon.history, mon.notEvaluated)
+	}
+}
+
+func TestAnalyseDataSeverity(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		samples []int
+		status  int
+	}{
+		{"major outage", []int{0, 4, 4, 0}, 4},
+		{"warnings only", []int{0, 3, 3, 0}, 3},
+		{"warning after a critical", []int{0, 4, 0, 3}, 4},
+		{"critical after a warning", []int{0, 3, 0, 4}, 4},
+		{"slow responses only", []int{0, 2, 2, 0}, 2},
+		{"slow response after an outage", []int{0, 4, 0, 2}, 4},
+		{"slow response after a warning", []int{0, 3, 0, 2}, 3},
+	} {
+		stub, api := startCachetStub(t)
+		mon := newAnalysedMonitor(t, api)
+		for _, sample := range tc.samples {
+			mon.record(sample == 0, sample)
+		}
+
+		mon.AnalyseData(logrus.WithFields(logrus.Fields{}))
+		if status := stub.lastStatus(); status != tc.status {
+			t.Errorf("%s: expected component status %d, got %d", tc.name, tc.status, status)
+		}
+	}
+}
+
+func TestStateChangeRate(t *testing.T) {
+	mon := AbstractMonitor{history: []bool{true, false, true, false, true}}
+	if rate := mon.stateChangeRate(); rate != 100 {
+		t.Errorf("alternating history should have a 100%% change rate, got %.2f", rate)
+	}
+
+	mon.history = []bool{true, true, true, false, false}
+	if rate := mon.stateChangeRate(); rate != 25 {
+		t.Errorf("single transition over 4 should be 25%%, got %.2f", rate)
+	}
+}
+
+func TestIsResolvable(t *testing.T) {
+	mon := AbstractMonitor{ResolveThreshold: 20}
+	if mon.isResolvable(3, 30) {
+		t.Error("30% down should not resolve with a 20% resolve threshold")
+	}
+	if !mon.isResolvable(1, 10) {
+		t.Error("10% down should resolve with a 20% resolve threshold")
+	}
+}
@@ -0,0 +1,187 @@
+package cachet
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+)
+
+// Seconds between the NTP (1900) and Unix (1970) epochs
+const ntpEpochOffset = 2208988800
+
+// DefaultNTPMaxStratum is the highest stratum of a synchronised server
+const DefaultNTPMaxStratum = 15
+
+// NTPMonitor queries an NTP server (Target, host[:123]) and checks its stratum and clock offset
+type NTPMonitor struct {
+	AbstractMonitor `mapstructure:",squash"`
+
+	// Highest stratum accepted (default: 15)
+	MaxStratum int `mapstructure:"max_stratum"`
+	// Highest clock offset accepted, in milliseconds (0: not checked)
+	MaxOffset int `mapstructure:"max_offset"`
+}
+
+// ntpResponse is the part of the server's response which is checked
+type ntpResponse struct {
+	leap    byte
+	stratum int
+	refID   string
+	offset  time.Duration
+	rtt     time.Duration
+}
+
+func (monitor *NTPMonitor) test(l *logrus.Entry) bool {
+	resp, err := monitor.query()
+	if err != nil {
+		monitor.lastFailReason = "NTP query failed: " + err.Error()
+		l.Infof("%s", monitor.lastFailReason)
+		return false
+	}
+	l.Debugf("NTP stratum %d, offset %v, round trip %v", resp.stratum, resp.offset, resp.rtt)
+
+	if reason := monitor.checkResponse(resp); len(reason) > 0 {
+		monitor.lastFailReason = reason
+		l.Infof("%s", monitor.lastFailReason)
+		return false
+	}
+
+	monitor.triggerShellHook(l, "on_success", monitor.ShellHookOnSuccess, "offset "+resp.offset.String())
+
+	return true
+}
+
+// checkResponse returns the fail reason when the server is not usable
+func (monitor *NTPMonitor) checkResponse(resp ntpResponse) string {
+	if resp.stratum == 0 {
+		return "NTP server sent a Kiss-o'-Death: " + resp.refID
+	}
+	if resp.leap == 3 {
+		return "NTP server is not synchronised (leap indicator alarm)"
+	}
+	if resp.stratum > monitor.MaxStratum {
+		return "NTP stratum " + strconv.Itoa(resp.stratum) + " above " + strconv.Itoa(monitor.MaxStratum)
+	}
+
+	offset := resp.offset
+	if offset < 0 {
+		offset = -offset
+	}
+	if monitor.MaxOffset > 0 && offset > time.Duration(monitor.MaxOffset)*time.Millisecond {
+		return "NTP clock offset " + strconv.FormatInt(resp.offset.Milliseconds(), 10) + "ms above " + strconv.Itoa(monitor.MaxOffset) + "ms"
+	}
+
+	return ""
+}
+
+// query sends a client (mode 3) request
+func (monitor *NTPMonitor) query() (ntpResponse, error) {
+	conn, err := net.DialTimeout("udp", monitor.Target, monitor.Timeout*time.Second)
+	if err != nil {
+		return ntpResponse{}, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(monitor.Timeout * time.Second))
+
+	request := make([]byte, 48)
+	// leap indicator 0, version 4, mode 3 (client)
+	request[0] = 0<<6 | 4<<3 | 3
+	sent := time.Now()
+	transmit := toNTPTime(sent)
+	binary.BigEndian.PutUint64(request[40:], transmit)
+
+	if _, err := conn.Write(request); err != nil {
+		return ntpResponse{}, err
+	}
+
+	response := make([]byte, 1024)
+	n, err := conn.Read(response)
+	received := time.Now()
+	if err != nil {
+		if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+			return ntpResponse{}, errors.New("no response within " + strconv.Itoa(int(monitor.Timeout)) + "s")
+		}
+		return ntpResponse{}, err
+	}
+	if n < 48 {
+		return ntpResponse{}, errors.New("short response (" + strconv.Itoa(n) + " bytes)")
+	}
+	if mode := response[0] & 0x7; mode != 4 {
+		return ntpResponse{}, errors.New("unexpected mode " + strconv.Itoa(int(mode)) + " in the response")
+	}
+	if binary.BigEndian.Uint64(response[24:]) != transmit {
+		return ntpResponse{}, errors.New("response does not match the request (origin timestamp)")
+	}
+
+	resp := ntpResponse{
+		leap:    response[0] >> 6,
+		stratum: int(response[1]),
+	}
+	if resp.stratum < 2 {
+		// kiss code or reference clock
+		resp.refID = string(response[12:16])
+	} else {
+		resp.refID = net.IP(response[12:16]).String()
+	}
+
+	serverReceived := fromNTPTime(binary.BigEndian.Uint64(response[32:]))
+	serverSent := fromNTPTime(binary.BigEndian.Uint64(response[40:]))
+	resp.offset = (serverReceived.Sub(sent) + serverSent.Sub(received)) / 2
+	resp.rtt = received.Sub(sent) - serverSent.Sub(serverReceived)
+
+	return resp, nil
+}
+
+func toNTPTime(t time.Time) uint64 {
+	seconds := uint64(t.Unix() + ntpEpochOffset)
+	fraction := uint64(t.Nanosecond()) << 32 / 1e9
+
+	return seconds<<32 | fraction
+}
+
+func fromNTPTime(ntp uint64) time.Time {
+	seconds := int64(ntp>>32) - ntpEpochOffset
+	nanoseconds := int64(math.Round(float64(ntp&0xffffffff) * 1e9 / (1 << 32)))
+
+	return time.Unix(seconds, nanoseconds)
+}
+
+func (mon *NTPMonitor) Validate() []string {
+	mon.Template.Investigating.SetDefault(defaultHTTPInvestigatingTpl)
+	mon.Template.Fixed.SetDefault(defaultHTTPFixedTpl)
+
+	errs := mon.AbstractMonitor.Validate()
+
+	if len(mon.Target) == 0 {
+		errs = append(errs, "'Target' has not been set")
+	} else if _, _, err := net.SplitHostPort(mon.Target); err != nil {
+		mon.Target = net.JoinHostPort(mon.Target, "123")
+	}
+
+	if mon.MaxStratum == 0 {
+		mon.MaxStratum = DefaultNTPMaxStratum
+	}
+	if mon.MaxStratum < 1 || mon.MaxStratum > DefaultNTPMaxStratum {
+		errs = append(errs, "'max_stratum' has to be between 1 and 15")
+	}
+	if mon.MaxOffset < 0 {
+		errs = append(errs, "'max_offset' cannot be negative")
+	}
+
+	return errs
+}
+
+func (mon *NTPMonitor) Describe() []string {
+	features := mon.AbstractMonitor.Describe()
+	features = append(features, "Max stratum: "+strconv.Itoa(mon.MaxStratum))
+	if mon.MaxOffset > 0 {
+		features = append(features, "Max offset: "+strconv.Itoa(mon.MaxOffset)+"ms")
+	}
+
+	return features
+}
@@ -0,0 +1,74 @@
+package cachet
+
+import (
+	"encoding/binary"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+)
+
+// startTestNTPServer answers with the given stratum and a clock shifted by offset
+func startTestNTPServer(t *testing.T, stratum byte, offset time.Duration) string {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	go func() {
+		buf := make([]byte, 48)
+		for {
+			_, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			now := toNTPTime(time.Now().Add(offset))
+			response := make([]byte, 48)
+			response[0] = 4<<3 | 4
+			response[1] = stratum
+			copy(response[12:16], "RATE")
+			copy(response[24:32], buf[40:48])
+			binary.BigEndian.PutUint64(response[32:], now)
+			binary.BigEndian.PutUint64(response[40:], now)
+			conn.WriteTo(response, addr)
+		}
+	}()
+
+	return conn.LocalAddr().String()
+}
+
+func TestNTPMonitor(t *testing.T) {
+	l := logrus.WithFields(logrus.Fields{})
+	mon := &NTPMonitor{MaxStratum: 3, MaxOffset: 500}
+	mon.Name, mon.Target, mon.ComponentID, mon.Timeout = "ntp", startTestNTPServer(t, 2, 100*time.Millisecond), 1, 1
+	if errs := mon.Validate(); len(errs) > 0 {
+		t.Fatalf("unexpected validation errors: %v", errs)
+	}
+	if !mon.test(l) {
+		t.Errorf("check should have passed: %s", mon.lastFailReason)
+	}
+
+	mon.Target = startTestNTPServer(t, 2, 2*time.Second)
+	if mon.test(l) || !strings.HasPrefix(mon.lastFailReason, "NTP clock offset ") || !strings.HasSuffix(mon.lastFailReason, "ms above 500ms") {
+		t.Errorf("unexpected fail reason: %s", mon.lastFailReason)
+	}
+
+	mon.Target = startTestNTPServer(t, 5, 0)
+	if mon.test(l) || mon.lastFailReason != "NTP stratum 5 above 3" {
+		t.Errorf("unexpected fail reason: %s", mon.lastFailReason)
+	}
+
+	mon.Target = startTestNTPServer(t, 0, 0)
+	if mon.test(l) || mon.lastFailReason != "NTP server sent a Kiss-o'-Death: RATE" {
+		t.Errorf("unexpected fail reason: %s", mon.lastFailReason)
+	}
+
+	mon = &NTPMonitor{}
+	mon.Name, mon.Target, mon.ComponentID, mon.Timeout = "ntp", "pool.ntp.org", 1, 1
+	if errs := mon.Validate(); len(errs) > 0 || mon.Target != "pool.ntp.org:123" || mon.MaxStratum != 15 {
+		t.Errorf("unexpected defaults: %v %s %d", errs, mon.Target, mon.MaxStratum)
+	}
+}
@@ -0,0 +1,100 @@
+package cachet
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/http/httpproxy"
+)
+
+// ProxyConfig routes requests through an HTTP (CONNECT) or SOCKS5 proxy.
+// Monitors without one connect directly.
+type ProxyConfig struct {
+	// http://, https:// or socks5:// proxy URL, "environment" uses HTTP_PROXY, HTTPS_PROXY
+	// and NO_PROXY, "direct" bypasses any proxy
+	URL      string `json:"url" yaml:"url" mapstructure:"url"`
+	Username string `json:"username" yaml:"username" mapstructure:"username"`
+	Password string `json:"password" yaml:"password" mapstructure:"password"`
+
+	// Hosts, domains (.example.com), IPs or CIDRs reached directly (localhost always is)
+	NoProxy []string `json:"no_proxy" yaml:"no_proxy" mapstructure:"no_proxy"`
+
+	proxyURL *url.URL
+}
+
+func (p *ProxyConfig) direct() bool {
+	return len(p.URL) == 0 || strings.ToLower(p.URL) == "direct"
+}
+
+func (p *ProxyConfig) environment() bool {
+	return strings.ToLower(p.URL) == "environment"
+}
+
+// Validate parses the proxy URL
+func (p *ProxyConfig) Validate() []string {
+	errs := []string{}
+
+	p.proxyURL = nil
+	if p.direct() || p.environment() {
+		return errs
+	}
+
+	u, err := url.Parse(p.URL)
+	if err != nil {
+		return append(errs, "Invalid proxy URL: "+err.Error())
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5":
+	default:
+		return append(errs, "Unsupported proxy scheme '"+u.Scheme+"' (expected http, https or socks5)")
+	}
+	if len(u.Host) == 0 {
+		return append(errs, "Proxy URL has no host: "+p.URL)
+	}
+
+	if len(p.Username) > 0 || len(p.Password) > 0 {
+		u.User = url.UserPassword(p.Username, p.Password)
+	}
+	p.proxyURL = u
+
+	return errs
+}
+
+// proxyFunc returns the http.Transport Proxy function (a nil config connects directly)
+func (p *ProxyConfig) proxyFunc() func(*http.Request) (*url.URL, error) {
+	if p == nil {
+		return nil
+	}
+
+	var proxy func(*url.URL) (*url.URL, error)
+	switch {
+	case p.environment():
+		// read on each call, unlike http.ProxyFromEnvironment
+		proxy = httpproxy.FromEnvironment().ProxyFunc()
+	case p.proxyURL != nil:
+		proxy = (&httpproxy.Config{
+			HTTPProxy:  p.proxyURL.String(),
+			HTTPSProxy: p.proxyURL.String(),
+			NoProxy:    strings.Join(p.NoProxy, ","),
+		}).ProxyFunc()
+	default:
+		return nil
+	}
+
+	return func(req *http.Request) (*url.URL, error) {
+		return proxy(req.URL)
+	}
+}
+
+// String describes the proxy without its credentials
+func (p *ProxyConfig) String() string {
+	if p != nil && p.environment() {
+		return "environment"
+	}
+	if p == nil || p.proxyURL == nil {
+		return "direct"
+	}
+
+	return p.proxyURL.Redacted()
+}
@@ -0,0 +1,78 @@
+package cachet
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Sirupsen/logrus"
+)
+
+func TestProxyConfig(t *testing.T) {
+	var proxied []string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Proxy-Authorization") != "Basic "+base64.StdEncoding.EncodeToString([]byte("monitor:s3cr3t")) {
+			w.WriteHeader(http.StatusProxyAuthRequired)
+			return
+		}
+		proxied = append(proxied, r.URL.String())
+		w.Write([]byte(`{"data":"Pong!"}`))
+	}))
+	defer proxy.Close()
+
+	l := logrus.WithFields(logrus.Fields{})
+	mon := &HTTPMonitor{ExpectedStatusCode: 200}
+	mon.Name, mon.Target, mon.ComponentID, mon.Timeout = "http", "http://status.internal.test/health", 1, 1
+	mon.Proxy = &ProxyConfig{URL: proxy.URL, Username: "monitor", Password: "s3cr3t"}
+	if errs := mon.Validate(); len(errs) > 0 {
+		t.Fatalf("unexpected validation errors: %v", errs)
+	}
+	if !mon.test(l) {
+		t.Errorf("check should have passed: %s", mon.lastFailReason)
+	}
+
+	api := CachetAPI{URL: "http://cachet.internal.test/api/v1", Proxy: &ProxyConfig{URL: proxy.URL, Username: "monitor", Password: "s3cr3t"}}
+	api.Proxy.Validate()
+	if err := api.Ping(); err != nil {
+		t.Errorf("ping through the proxy failed: %s", err)
+	}
+
+	if len(proxied) != 2 || proxied[0] != "http://status.internal.test/health" || proxied[1] != "http://cachet.internal.test/api/v1/ping" {
+		t.Errorf("unexpected proxied requests: %v", proxied)
+	}
+
+	// bypassed: the host does not resolve
+	mon.Proxy.NoProxy = []string{".internal.test"}
+	mon.Validate()
+	if mon.test(l) {
+		t.Error("check should have bypassed the proxy")
+	}
+	if len(proxied) != 2 {
+		t.Errorf("unexpected proxied requests: %v", proxied)
+	}
+
+	// without a proxy, the environment is only used when asked to
+	t.Setenv("HTTP_PROXY", proxy.URL)
+	mon.Proxy = nil
+	mon.Validate()
+	if mon.test(l) {
+		t.Error("check without a proxy should have connected directly")
+	}
+	mon.Proxy = &ProxyConfig{URL: "environment"}
+	if errs := mon.Validate(); len(errs) > 0 {
+		t.Fatalf("unexpected validation errors: %v", errs)
+	}
+	mon.test(l)
+	if len(proxied) != 2 {
+		t.Errorf("unexpected proxied requests: %v", proxied)
+	}
+	if mon.lastFailReason != "Expected HTTP response status: 200, got: 407" {
+		t.Errorf("check should have used the environment proxy: %s", mon.lastFailReason)
+	}
+
+	invalid := &ProxyConfig{URL: "ftp://proxy:21"}
+	if errs := invalid.Validate(); len(errs) != 1 || errs[0] != "Unsupported proxy scheme 'ftp' (expected http, https or socks5)" {
+		t.Errorf("unexpected validation errors: %v", errs)
+	}
+}
@@ -0,0 +1,174 @@
+package cachet
+
+import (
+	"encoding/json"
+	"errors"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+)
+
+// QuorumConfig coordinates several locations (instances identified by their
+// system_name) monitoring the same components: a component's status is only
+// changed when enough locations agree
+type QuorumConfig struct {
+	Store StoreConfig `json:"store" yaml:"store"`
+	// Number of locations which have to see the failure
+	Locations int `json:"locations" yaml:"locations"`
+	// Seconds after which a location's verdict is ignored (defaults to 3 intervals)
+	TTL time.Duration `json:"ttl" yaml:"ttl"`
+
+	store Store
+}
+
+// Verdict is the status of a monitor as seen from a location
+type Verdict struct {
+	Location   string `json:"location"`
+	Status     int    `json:"status"`
+	FailReason string `json:"fail_reason"`
+	Time       int64  `json:"time"`
+}
+
+func (q *QuorumConfig) Validate() []string {
+	errs := []string{}
+
+	if q.Locations < 1 {
+		errs = append(errs, "Quorum: 'locations' must be at least 1")
+	}
+	if q.TTL < 0 {
+		q.TTL = 0
+	}
+
+	store, err := q.Store.Open()
+	if err != nil {
+		errs = append(errs, "Quorum: "+err.Error())
+	}
+	q.store = store
+
+	return errs
+}
+
+func verdictPrefix(monitor string) string {
+	return "verdict/" + monitor + "/"
+}
+
+// quorumVerdict publishes the local verdict and replaces it with the one agreed by the locations
+func (mon *AbstractMonitor) quorumVerdict(l *logrus.Entry, triggered bool, criticalTriggered bool, partialTriggered bool) (bool, bool, bool) {
+	q := mon.config.Quorum
+
+	local := Verdict{
+		Location: mon.config.SystemName,
+		Status:   1,
+		Time:     time.Now().Unix(),
+	}
+	if triggered || criticalTriggered {
+		local.Status = 4
+	} else if partialTriggered {
+		local.Status = 3
+	}
+	if local.Status > 1 {
+		local.FailReason = mon.lastFailReason
+	}
+
+	verdicts, err := mon.exchangeVerdicts(local)
+	if err != nil {
+		// only our own verdict is known
+		l.Warnf("Could not share verdict with the other locations: %v", err)
+		verdicts = []Verdict{local}
+	}
+
+	ttl := q.TTL * time.Second
+	if ttl == 0 {
+		ttl = 3 * mon.Interval * time.Second
+	}
+
+	down := []Verdict{}
+	major := 0
+	for _, v := range verdicts {
+		if time.Since(time.Unix(v.Time, 0)) > ttl {
+			l.Debugf("Ignoring outdated verdict from %s", v.Location)
+			continue
+		}
+		if v.Status > 1 {
+			down = append(down, v)
+		}
+		if v.Status == 4 {
+			major++
+		}
+	}
+
+	sort.Slice(down, func(i, j int) bool { return down[i].Location < down[j].Location })
+	mon.failingLocations = down
+
+	l.Debugf("Quorum: %d location(s) down, %d required", len(down), q.Locations)
+	if len(down) < q.Locations {
+		if local.Status > 1 {
+			l.Infof("Failure not confirmed by enough locations (%d/%d)", len(down), q.Locations)
+		}
+		return false, false, false
+	}
+
+	// another location may already have opened the incident
+	if mon.incident == nil {
+		mon.incident, _ = (&Component{ID: mon.ComponentID}).LoadCurrentIncident(mon.config)
+		if mon.incident != nil {
+			mon.incidentSince = time.Now()
+		}
+	}
+
+	if major >= q.Locations {
+		return false, true, false
+	}
+
+	return false, false, true
+}
+
+// exchangeVerdicts stores the local verdict and reads all locations' ones
+func (mon *AbstractMonitor) exchangeVerdicts(local Verdict) ([]Verdict, error) {
+	store := mon.config.Quorum.store
+	if store == nil {
+		return nil, errors.New("store is not available")
+	}
+
+	data, _ := json.Marshal(local)
+	if err := store.Put(verdictPrefix(mon.Name)+local.Location, data); err != nil {
+		return nil, err
+	}
+
+	values, err := store.List(verdictPrefix(mon.Name))
+	if err != nil {
+		return nil, err
+	}
+
+	verdicts := []Verdict{}
+	for key, value := range values {
+		var v Verdict
+		if err := json.Unmarshal(value, &v); err != nil {
+			logrus.Warnf("Invalid verdict '%s' in store: %v", key, err)
+			continue
+		}
+		verdicts = append(verdicts, v)
+	}
+
+	return verdicts, nil
+}
+
+// describeFailingLocations lists the locations seeing the failure (and why)
+func (mon *AbstractMonitor) describeFailingLocations() string {
+	if len(mon.failingLocations) == 0 {
+		return ""
+	}
+
+	lines := []string{"Failing locations:"}
+	for _, v := range mon.failingLocations {
+		line := "- " + v.Location
+		if len(v.FailReason) > 0 {
+			line += ": " + v.FailReason
+		}
+		lines = append(lines, line)
+	}
+
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,85 @@
+package cachet
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+)
+
+// newQuorumMonitor returns a monitor of the "eu" location sharing its verdicts in a file store
+func newQuorumMonitor(t *testing.T, locations int, ttl time.Duration) *AbstractMonitor {
+	_, api := startCachetStub(t)
+	mon := newAnalysedMonitor(t, api)
+	mon.config.SystemName = "eu"
+	mon.config.Quorum = &QuorumConfig{Store: StoreConfig{Type: "file", Path: t.TempDir()}, Locations: locations, TTL: ttl}
+	if errs := mon.config.Quorum.Validate(); len(errs) > 0 {
+		t.Fatalf("unexpected validation errors: %v", errs)
+	}
+
+	return mon
+}
+
+func TestQuorumVerdict(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		locations int
+		ttl       time.Duration
+		// verdict of the "us" location, none when 0
+		status   int
+		age      time.Duration
+		critical bool
+		partial  bool
+		failing  int
+	}{
+		{"alone", 1, 0, 0, 0, true, false, 1},
+		{"not confirmed", 2, 0, 1, 0, false, false, 1},
+		{"major agreed", 2, 0, 4, 0, true, false, 2},
+		{"partial agreed", 2, 0, 3, 0, false, true, 2},
+		{"stale verdict", 2, 0, 4, time.Hour, false, false, 1},
+		{"verdict within ttl", 2, 7200, 4, time.Hour, true, false, 2},
+	} {
+		mon := newQuorumMonitor(t, tc.locations, tc.ttl)
+		if tc.status > 0 {
+			data, _ := json.Marshal(Verdict{Location: "us", Status: tc.status, Time: time.Now().Add(-tc.age).Unix()})
+			mon.config.Quorum.store.Put(verdictPrefix(mon.Name)+"us", data)
+		}
+
+		triggered, critical, partial := mon.quorumVerdict(logrus.WithFields(logrus.Fields{}), true, false, false)
+		if triggered || critical != tc.critical || partial != tc.partial {
+			t.Errorf("%s: unexpected verdict (triggered: %t, critical: %t, partial: %t)", tc.name, triggered, critical, partial)
+		}
+		if len(mon.failingLocations) != tc.failing {
+			t.Errorf("%s: expected %d failing locations, got %v", tc.name, tc.failing, mon.failingLocations)
+		}
+	}
+
+	// the local verdict is shared
+	mon := newQuorumMonitor(t, 2, 0)
+	mon.lastFailReason = "connection refused"
+	mon.quorumVerdict(logrus.WithFields(logrus.Fields{}), false, false, true)
+	var local Verdict
+	data, _ := mon.config.Quorum.store.Get(verdictPrefix(mon.Name) + "eu")
+	if err := json.Unmarshal(data, &local); err != nil || local.Status != 3 || local.FailReason != "connection refused" {
+		t.Errorf("unexpected stored verdict: %s (%v)", data, err)
+	}
+}
+
+func TestQuorumVerdictStoreError(t *testing.T) {
+	l := logrus.WithFields(logrus.Fields{})
+
+	// only the local verdict is known
+	mon := newQuorumMonitor(t, 1, 0)
+	os.RemoveAll(mon.config.Quorum.Store.Path)
+	if _, critical, _ := mon.quorumVerdict(l, true, false, false); !critical {
+		t.Error("local verdict should be enough for a quorum of 1")
+	}
+
+	mon = newQuorumMonitor(t, 2, 0)
+	mon.config.Quorum.store = nil
+	if triggered, critical, partial := mon.quorumVerdict(l, true, false, false); triggered || critical || partial {
+		t.Error("local verdict alone should not reach a quorum of 2")
+	}
+}
@@ -0,0 +1,140 @@
+package cachet
+
+import (
+	"errors"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// DefaultMaxRedirects is the Go client's default
+const DefaultMaxRedirects = 10
+
+// RedirectPolicy controls how HTTP monitors follow redirects and what they expect from them
+type RedirectPolicy struct {
+	// true / false or the maximum number of redirects (default: 10)
+	FollowRedirects interface{} `mapstructure:"follow_redirects"`
+	maxRedirects    int
+
+	// Regexps the final URL / the final response's Location header have to match
+	ExpectedURL      string `mapstructure:"expected_url"`
+	urlRegexp        *regexp.Regexp
+	ExpectedLocation string `mapstructure:"expected_location"`
+	locationRegexp   *regexp.Regexp
+
+	// Fail when a redirect goes to another host / from https to http
+	RedirectSameHost  bool `mapstructure:"redirect_same_host"`
+	RedirectKeepHTTPS bool `mapstructure:"redirect_keep_https"`
+}
+
+// redirectError is returned by checkRedirect (client.Do wraps it)
+type redirectError struct {
+	reason string
+}
+
+func (e *redirectError) Error() string {
+	return e.reason
+}
+
+func (p *RedirectPolicy) validate() []string {
+	errs := []string{}
+
+	switch v := p.FollowRedirects.(type) {
+	case nil:
+		p.maxRedirects = DefaultMaxRedirects
+	case bool:
+		p.maxRedirects = 0
+		if v {
+			p.maxRedirects = DefaultMaxRedirects
+		}
+	case int:
+		p.maxRedirects = v
+	case float64:
+		// JSON configuration
+		p.maxRedirects = int(v)
+	default:
+		errs = append(errs, "'follow_redirects' must be a boolean or a number")
+	}
+	if p.maxRedirects < 0 {
+		errs = append(errs, "'follow_redirects' cannot be negative")
+	}
+
+	var err error
+	p.urlRegexp, p.locationRegexp = nil, nil
+	if len(p.ExpectedURL) > 0 {
+		if p.urlRegexp, err = regexp.Compile(p.ExpectedURL); err != nil {
+			errs = append(errs, "Regexp compilation failure: "+err.Error())
+		}
+	}
+	if len(p.ExpectedLocation) > 0 {
+		if p.locationRegexp, err = regexp.Compile(p.ExpectedLocation); err != nil {
+			errs = append(errs, "Regexp compilation failure: "+err.Error())
+		}
+	}
+
+	return errs
+}
+
+// checkRedirect is used as http.Client.CheckRedirect
+func (p *RedirectPolicy) checkRedirect(req *http.Request, via []*http.Request) error {
+	if p.maxRedirects == 0 {
+		return http.ErrUseLastResponse
+	}
+
+	previous := via[len(via)-1].URL
+	if p.RedirectSameHost && req.URL.Host != via[0].URL.Host {
+		return &redirectError{"Redirected to another host: " + previous.String() + " -> " + req.URL.String()}
+	}
+	if p.RedirectKeepHTTPS && previous.Scheme == "https" && req.URL.Scheme != "https" {
+		return &redirectError{"Redirected from HTTPS to HTTP: " + previous.String() + " -> " + req.URL.String()}
+	}
+
+	if len(via) > p.maxRedirects {
+		chain := []string{}
+		for _, r := range via {
+			chain = append(chain, r.URL.String())
+		}
+		chain = append(chain, req.URL.String())
+		return &redirectError{"Stopped after " + strconv.Itoa(p.maxRedirects) + " redirects: " + strings.Join(chain, " -> ")}
+	}
+
+	return nil
+}
+
+// checkResponse asserts the final URL and Location header
+func (p *RedirectPolicy) checkResponse(resp *http.Response) error {
+	if p.urlRegexp != nil && !p.urlRegexp.MatchString(resp.Request.URL.String()) {
+		return errors.New("Unexpected final URL: " + resp.Request.URL.String() + ".\nExpected to match: " + p.ExpectedURL)
+	}
+
+	if p.locationRegexp != nil {
+		location := resp.Header.Get("Location")
+		if len(location) == 0 {
+			return errors.New("No Location header (HTTP response status: " + strconv.Itoa(resp.StatusCode) + ")")
+		}
+		if !p.locationRegexp.MatchString(location) {
+			return errors.New("Unexpected Location header: " + location + ".\nExpected to match: " + p.ExpectedLocation)
+		}
+	}
+
+	return nil
+}
+
+func (p *RedirectPolicy) describe() []string {
+	features := []string{"Follow redirects: " + strconv.Itoa(p.maxRedirects)}
+	if len(p.ExpectedURL) > 0 {
+		features = append(features, "Expected final URL: "+p.ExpectedURL)
+	}
+	if len(p.ExpectedLocation) > 0 {
+		features = append(features, "Expected Location: "+p.ExpectedLocation)
+	}
+	if p.RedirectSameHost {
+		features = append(features, "Redirects limited to the same host")
+	}
+	if p.RedirectKeepHTTPS {
+		features = append(features, "Redirects to HTTP forbidden")
+	}
+
+	return features
+}
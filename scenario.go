@@ -0,0 +1,320 @@
+package cachet
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+)
+
+// HTTPScenarioMonitor runs ordered HTTP steps sharing cookies and extracted values
+type HTTPScenarioMonitor struct {
+	AbstractMonitor `mapstructure:",squash"`
+
+	Steps []HTTPStep
+
+	Proxy *ProxyConfig
+}
+
+// HTTPStep is a request of a scenario. URL, headers and body are templates
+// receiving the values extracted by the previous steps ({{ .token }}).
+type HTTPStep struct {
+	Name string
+	// Relative URLs are resolved against the monitor's target
+	URL     string
+	Method  string
+	Headers map[string]string
+	Body    string
+
+	ExpectedStatusCode int    `mapstructure:"expected_status_code"`
+	ExpectedBody       string `mapstructure:"expected_body"`
+	bodyRegexp         *regexp.Regexp
+
+	Extract []HTTPExtract
+
+	urlTpl     *template.Template
+	headerTpls map[string]*template.Template
+	bodyTpl    *template.Template
+}
+
+// HTTPExtract stores a value of the response under Name
+type HTTPExtract struct {
+	Name string
+	// Header to read (the body is used when blank)
+	Header string
+	// First capture group (or the whole match) of this regexp...
+	Regex  string
+	regexp *regexp.Regexp
+	// ...or value at this path of the JSON body
+	JSONPath string `mapstructure:"json_path"`
+}
+
+func (monitor *HTTPScenarioMonitor) test(l *logrus.Entry) bool {
+	jar, _ := cookiejar.New(nil)
+	client := &http.Client{
+		Timeout: monitor.Timeout * time.Second,
+		Jar:     jar,
+		Transport: &http.Transport{
+			Proxy:           monitor.Proxy.proxyFunc(),
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: !monitor.Strict},
+		},
+	}
+
+	values := map[string]string{}
+	for i := range monitor.Steps {
+		step := &monitor.Steps[i]
+
+		if err := monitor.runStep(l, client, step, values); err != nil {
+			monitor.lastFailReason = "Step " + strconv.Itoa(i+1) + " (" + step.Name + ") failed: " + err.Error()
+			l.Infof("%s", monitor.lastFailReason)
+			return false
+		}
+	}
+
+	monitor.triggerShellHook(l, "on_success", monitor.ShellHookOnSuccess, "")
+
+	return true
+}
+
+func (monitor *HTTPScenarioMonitor) runStep(l *logrus.Entry, client *http.Client, step *HTTPStep, values map[string]string) error {
+	rawURL, err := execStepTemplate(step.urlTpl, values)
+	if err != nil {
+		return err
+	}
+	target, err := monitor.resolveURL(rawURL)
+	if err != nil {
+		return err
+	}
+
+	body, err := execStepTemplate(step.bodyTpl, values)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(step.Method, target, strings.NewReader(body))
+	if err != nil {
+		return err
+	}
+	for k, tpl := range step.headerTpls {
+		v, err := execStepTemplate(tpl, values)
+		if err != nil {
+			return err
+		}
+		req.Header.Add(k, v)
+	}
+	req.Header.Set("User-Agent", "Cachet-Monitor")
+
+	l.Debugf("Step %s: %s %s", step.Name, step.Method, target)
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if step.ExpectedStatusCode > 0 && resp.StatusCode != step.ExpectedStatusCode {
+		return errors.New("Expected HTTP response status: " + strconv.Itoa(step.ExpectedStatusCode) + ", got: " + strconv.Itoa(resp.StatusCode))
+	}
+
+	responseBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if step.bodyRegexp != nil && !step.bodyRegexp.Match(responseBody) {
+		return errors.New("Unexpected body: " + string(responseBody) + ".\nExpected to match: " + step.ExpectedBody)
+	}
+
+	for _, extract := range step.Extract {
+		value, err := extract.extract(resp.Header, responseBody)
+		if err != nil {
+			return errors.New("Could not extract '" + extract.Name + "': " + err.Error())
+		}
+		values[extract.Name] = value
+	}
+
+	return nil
+}
+
+func (extract *HTTPExtract) extract(header http.Header, body []byte) (string, error) {
+	source := string(body)
+	if len(extract.Header) > 0 {
+		if _, ok := header[http.CanonicalHeaderKey(extract.Header)]; !ok {
+			return "", errors.New("no '" + extract.Header + "' header")
+		}
+		source = header.Get(extract.Header)
+	}
+
+	if extract.regexp != nil {
+		match := extract.regexp.FindStringSubmatch(source)
+		if match == nil {
+			return "", errors.New("no match for " + extract.Regex)
+		}
+		if len(match) > 1 {
+			return match[1], nil
+		}
+		return match[0], nil
+	}
+
+	if len(extract.JSONPath) > 0 {
+		var doc interface{}
+		if err := json.Unmarshal([]byte(source), &doc); err != nil {
+			return "", errors.New("invalid JSON: " + err.Error())
+		}
+		value, err := jsonPathLookup(doc, extract.JSONPath)
+		if err != nil {
+			return "", err
+		}
+		return jsonValueString(value), nil
+	}
+
+	return source, nil
+}
+
+func (monitor *HTTPScenarioMonitor) resolveURL(rawURL string) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", err
+	}
+	if u.IsAbs() || len(monitor.Target) == 0 {
+		return u.String(), nil
+	}
+
+	base, err := url.Parse(monitor.Target)
+	if err != nil {
+		return "", err
+	}
+
+	return base.ResolveReference(u).String(), nil
+}
+
+func execStepTemplate(tpl *template.Template, values map[string]string) (string, error) {
+	if tpl == nil {
+		return "", nil
+	}
+
+	buf := new(bytes.Buffer)
+	if err := tpl.Execute(buf, values); err != nil {
+		return "", err
+	}
+
+	return buf.String(), nil
+}
+
+func compileStepTemplate(name string, text string) (*template.Template, error) {
+	return template.New(name).Option("missingkey=error").Parse(text)
+}
+
+func (mon *HTTPScenarioMonitor) Validate() []string {
+	mon.Template.Investigating.SetDefault(defaultHTTPInvestigatingTpl)
+	mon.Template.Fixed.SetDefault(defaultHTTPFixedTpl)
+
+	errs := mon.AbstractMonitor.Validate()
+
+	if len(mon.Steps) == 0 {
+		errs = append(errs, "No 'steps' defined")
+	}
+
+	if mon.Proxy != nil {
+		errs = append(errs, mon.Proxy.Validate()...)
+	}
+
+	if time.Duration(len(mon.Steps))*mon.Timeout > mon.Interval {
+		errs = append(errs, "Steps (timeout each) do not fit within the interval")
+	}
+
+	for i := range mon.Steps {
+		step := &mon.Steps[i]
+		prefix := "Step " + strconv.Itoa(i+1) + ": "
+
+		if len(step.Name) == 0 {
+			step.Name = "#" + strconv.Itoa(i+1)
+		}
+		if len(step.URL) == 0 {
+			errs = append(errs, prefix+"'url' has not been set")
+		}
+
+		step.Method = strings.ToUpper(step.Method)
+		switch step.Method {
+		case "GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS", "HEAD":
+		case "":
+			step.Method = "GET"
+		default:
+			errs = append(errs, prefix+"Unsupported HTTP method: "+step.Method)
+		}
+
+		var err error
+		if step.urlTpl, err = compileStepTemplate("url", step.URL); err != nil {
+			errs = append(errs, prefix+"Could not compile 'url': "+err.Error())
+		}
+		step.bodyTpl = nil
+		if len(step.Body) > 0 {
+			if step.bodyTpl, err = compileStepTemplate("body", step.Body); err != nil {
+				errs = append(errs, prefix+"Could not compile 'body': "+err.Error())
+			}
+		}
+		step.headerTpls = map[string]*template.Template{}
+		for k, v := range step.Headers {
+			if step.headerTpls[k], err = compileStepTemplate(k, v); err != nil {
+				errs = append(errs, prefix+"Could not compile header '"+k+"': "+err.Error())
+			}
+		}
+
+		step.bodyRegexp = nil
+		if len(step.ExpectedBody) > 0 {
+			if step.bodyRegexp, err = regexp.Compile(step.ExpectedBody); err != nil {
+				errs = append(errs, prefix+"Regexp compilation failure: "+err.Error())
+			}
+		}
+
+		for j := range step.Extract {
+			extract := &step.Extract[j]
+			if len(extract.Name) == 0 {
+				errs = append(errs, prefix+"extracted values need a 'name'")
+			}
+			if len(extract.Regex) > 0 && len(extract.JSONPath) > 0 {
+				errs = append(errs, prefix+"'regex' and 'json_path' are exclusive ('"+extract.Name+"')")
+			}
+
+			extract.regexp = nil
+			if len(extract.Regex) > 0 {
+				if extract.regexp, err = regexp.Compile(extract.Regex); err != nil {
+					errs = append(errs, prefix+"Regexp compilation failure: "+err.Error())
+				}
+			}
+			if len(extract.JSONPath) > 0 {
+				if _, err := parseJSONPath(extract.JSONPath); err != nil {
+					errs = append(errs, prefix+"Invalid 'json_path': "+err.Error())
+				}
+			}
+		}
+	}
+
+	return errs
+}
+
+func (mon *HTTPScenarioMonitor) Describe() []string {
+	features := mon.AbstractMonitor.Describe()
+	features = append(features, "Insecure: "+strconv.FormatBool(!mon.Strict))
+	if mon.Proxy != nil {
+		features = append(features, "Proxy: "+mon.Proxy.String())
+	}
+
+	steps := []string{}
+	for _, step := range mon.Steps {
+		steps = append(steps, step.Name)
+	}
+	features = append(features, "Steps: "+strings.Join(steps, " > "))
+
+	return features
+}
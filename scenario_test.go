@@ -0,0 +1,103 @@
+package cachet
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Sirupsen/logrus"
+)
+
+func TestJSONPathLookup(t *testing.T) {
+	var doc interface{}
+	json.Unmarshal([]byte(`{"data":{"items":[{"id":1},{"id":2,"tags":["a"]}],"a key":"v"}}`), &doc)
+
+	for path, expected := range map[string]string{
+		"$.data.items[1].id":      "2",
+		"data.items[-1].tags":     `["a"]`,
+		"$.data['a key']":         "v",
+		`$["data"].items[0]`:      `{"id":1}`,
+		"$.data.items[2]":         "error",
+		"$.data.missing":          "error",
+		"$.data.items[0].id.deep": "error",
+	} {
+		value, err := jsonPathLookup(doc, path)
+		if err != nil {
+			if expected != "error" {
+				t.Errorf("%s: %v", path, err)
+			}
+			continue
+		}
+		if jsonValueString(value) != expected {
+			t.Errorf("%s: expected %s, got %s", path, expected, jsonValueString(value))
+		}
+	}
+}
+
+func TestHTTPScenarioMonitor(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/login", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" || r.FormValue("user") != "monitor" {
+			http.Error(w, "denied", http.StatusForbidden)
+			return
+		}
+		http.SetCookie(w, &http.Cookie{Name: "session", Value: "s1"})
+		w.Header().Set("X-Request-Id", "req-42")
+		w.Write([]byte(`{"data":{"token":"abc"}}`))
+	})
+	mux.HandleFunc("/api/req-42", func(w http.ResponseWriter, r *http.Request) {
+		if c, err := r.Cookie("session"); err != nil || c.Value != "s1" || r.Header.Get("Authorization") != "Bearer abc" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(`{"status":"ok"}`))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	mon := &HTTPScenarioMonitor{Steps: []HTTPStep{
+		{
+			Name:               "login",
+			URL:                "/login",
+			Method:             "post",
+			Headers:            map[string]string{"Content-Type": "application/x-www-form-urlencoded"},
+			Body:               "user=monitor",
+			ExpectedStatusCode: 200,
+			Extract: []HTTPExtract{
+				{Name: "token", JSONPath: "$.data.token"},
+				{Name: "request", Header: "X-Request-Id", Regex: "req-[0-9]+"},
+			},
+		},
+		{
+			Name:               "call API",
+			URL:                "/api/{{ .request }}",
+			Headers:            map[string]string{"Authorization": "Bearer {{ .token }}"},
+			ExpectedStatusCode: 200,
+			ExpectedBody:       `"status":"ok"`,
+		},
+	}}
+	mon.Name, mon.Target, mon.ComponentID, mon.Timeout = "scenario", server.URL, 1, 1
+	if errs := mon.Validate(); len(errs) > 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+
+	l := logrus.WithFields(logrus.Fields{})
+	if !mon.test(l) {
+		t.Errorf("scenario should have passed: %s", mon.lastFailReason)
+	}
+
+	mon.Steps[0].Body = "user=nobody"
+	mon.Validate()
+	if mon.test(l) || mon.lastFailReason != "Step 1 (login) failed: Expected HTTP response status: 200, got: 403" {
+		t.Errorf("unexpected fail reason: %s", mon.lastFailReason)
+	}
+
+	mon.Steps[0].Body = "user=monitor"
+	mon.Steps[0].ExpectedStatusCode = 0
+	mon.Steps[0].Extract = mon.Steps[0].Extract[:1]
+	mon.Validate()
+	if mon.test(l) || mon.lastFailReason != `Step 2 (call API) failed: template: url:1:8: executing "url" at <.request>: map has no entry for key "request"` {
+		t.Errorf("unexpected fail reason: %s", mon.lastFailReason)
+	}
+}
@@ -0,0 +1,56 @@
+package cachet
+
+import (
+	"time"
+)
+
+// Date format used by Cachet for schedules
+const cachetDateFormat = "2006-01-02 15:04:05"
+
+// Schedule Cachet data model (scheduled maintenance)
+type Schedule struct {
+	ID          int         `json:"id"`
+	Name        string      `json:"name"`
+	Message     string      `json:"message"`
+	Status      int         `json:"status"`
+	ScheduledAt string      `json:"scheduled_at"`
+	CompletedAt string      `json:"completed_at"`
+	Components  []Component `json:"components"`
+}
+
+// Covers tells if the schedule has been declared for the given component
+func (schedule *Schedule) Covers(componentID int) bool {
+	for _, comp := range schedule.Components {
+		if comp.ID == componentID {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Active tells if the schedule is in progress
+func (schedule *Schedule) Active(now time.Time) bool {
+	switch schedule.Status {
+	case 1:
+		// in progress
+		return true
+	case 2:
+		// complete
+		return false
+	}
+
+	// upcoming: rely on dates as the status may lag behind
+	start, err := time.ParseInLocation(cachetDateFormat, schedule.ScheduledAt, time.Local)
+	if err != nil || now.Before(start) {
+		return false
+	}
+
+	if len(schedule.CompletedAt) == 0 {
+		return true
+	}
+
+	end, err := time.ParseInLocation(cachetDateFormat, schedule.CompletedAt, time.Local)
+
+	return err == nil && now.Before(end)
+}
@@ -0,0 +1,168 @@
+package cachet
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Store is a minimal key/value store shared between cachet-monitor instances
+type Store interface {
+	// Get returns nil (and no error) when the key does not exist
+	Get(key string) ([]byte, error)
+	Put(key string, value []byte) error
+	// List returns all the keys (and their values) starting with prefix
+	List(prefix string) (map[string][]byte, error)
+	// CompareAndSwap stores value only if the current one is still old (nil: the key must not exist)
+	CompareAndSwap(key string, old []byte, value []byte) (bool, error)
+}
+
+// Lock directories older than this are considered abandoned
+const fileStoreLockTimeout = 10 * time.Second
+
+// StoreConfig describes how to reach the shared store
+type StoreConfig struct {
+	// file (directory on a shared storage) or http (see KVServer)
+	Type string `json:"type" yaml:"type"`
+	// Directory used by the file store
+	Path string `json:"path" yaml:"path"`
+	// Base URL of the http store
+	URL   string `json:"url" yaml:"url"`
+	Token string `json:"token" yaml:"token"`
+}
+
+// Open validates the configuration and returns the matching Store
+func (c *StoreConfig) Open() (Store, error) {
+	switch strings.ToLower(c.Type) {
+	case "file":
+		if len(c.Path) == 0 {
+			return nil, errors.New("file store: 'path' is required")
+		}
+		if err := os.MkdirAll(c.Path, 0755); err != nil {
+			return nil, errors.New("file store: " + err.Error())
+		}
+
+		return &FileStore{Dir: c.Path}, nil
+	case "http":
+		if len(c.URL) == 0 {
+			return nil, errors.New("http store: 'url' is required")
+		}
+
+		return NewHTTPStore(c.URL, c.Token), nil
+	}
+
+	return nil, errors.New("unknown store type '" + c.Type + "' (expected file or http)")
+}
+
+// FileStore keeps one file per key in a (shared) directory
+type FileStore struct {
+	Dir string
+}
+
+func (s *FileStore) path(key string) string {
+	return filepath.Join(s.Dir, url.QueryEscape(key))
+}
+
+func (s *FileStore) Get(key string) ([]byte, error) {
+	data, err := ioutil.ReadFile(s.path(key))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+
+	return data, err
+}
+
+func (s *FileStore) Put(key string, value []byte) error {
+	// write then rename so that readers never see a partial value
+	tmp := filepath.Join(s.Dir, ".tmp-"+url.QueryEscape(key)+"-"+strconv.FormatInt(time.Now().UnixNano(), 10))
+	if err := ioutil.WriteFile(tmp, value, 0644); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmp, s.path(key)); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	return nil
+}
+
+func (s *FileStore) List(prefix string) (map[string][]byte, error) {
+	files, err := ioutil.ReadDir(s.Dir)
+	if err != nil {
+		return nil, err
+	}
+
+	values := map[string][]byte{}
+	for _, file := range files {
+		if file.IsDir() || strings.HasPrefix(file.Name(), ".") {
+			continue
+		}
+
+		key, err := url.QueryUnescape(file.Name())
+		if err != nil || !strings.HasPrefix(key, prefix) {
+			continue
+		}
+
+		data, err := ioutil.ReadFile(filepath.Join(s.Dir, file.Name()))
+		if err != nil {
+			// removed in between
+			continue
+		}
+		values[key] = data
+	}
+
+	return values, nil
+}
+
+func (s *FileStore) CompareAndSwap(key string, old []byte, value []byte) (bool, error) {
+	unlock, err := s.lock(key)
+	if err != nil {
+		return false, err
+	}
+	defer unlock()
+
+	current, err := s.Get(key)
+	if err != nil {
+		return false, err
+	}
+
+	if (old == nil) != (current == nil) || !bytes.Equal(current, old) {
+		return false, nil
+	}
+
+	return true, s.Put(key, value)
+}
+
+// lock relies on mkdir being atomic (NFS included) to serialize writers of a key
+func (s *FileStore) lock(key string) (func(), error) {
+	dir := filepath.Join(s.Dir, ".lock-"+url.QueryEscape(key))
+	deadline := time.Now().Add(fileStoreLockTimeout)
+
+	for {
+		err := os.Mkdir(dir, 0755)
+		if err == nil {
+			return func() { os.Remove(dir) }, nil
+		}
+		if !os.IsExist(err) {
+			return nil, err
+		}
+
+		if info, err := os.Stat(dir); err == nil && time.Since(info.ModTime()) > fileStoreLockTimeout {
+			// the holder died while holding the lock
+			os.Remove(dir)
+			continue
+		}
+
+		if time.Now().After(deadline) {
+			return nil, errors.New("timed out waiting for lock on '" + key + "'")
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
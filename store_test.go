@@ -0,0 +1,104 @@
+package cachet
+
+import (
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+)
+
+func testStore(t *testing.T, store Store) {
+	if value, err := store.Get("missing"); err != nil || value != nil {
+		t.Errorf("missing key should return nil without error, got %v, %v", value, err)
+	}
+
+	if err := store.Put("verdict/web/eu", []byte("down")); err != nil {
+		t.Fatalf("put failed: %v", err)
+	}
+	store.Put("verdict/web/us", []byte("up"))
+	store.Put("verdict/api/eu", []byte("up"))
+
+	if value, _ := store.Get("verdict/web/eu"); string(value) != "down" {
+		t.Errorf("unexpected value: %s", value)
+	}
+
+	values, err := store.List("verdict/web/")
+	if err != nil || len(values) != 2 || string(values["verdict/web/us"]) != "up" {
+		t.Errorf("unexpected list result: %v, %v", values, err)
+	}
+
+	if ok, err := store.CompareAndSwap("verdict/web/eu", nil, []byte("up")); ok || err != nil {
+		t.Errorf("swapping an existing key as missing should fail without error (%t, %v)", ok, err)
+	}
+	if ok, _ := store.CompareAndSwap("verdict/web/eu", []byte("up"), []byte("up")); ok {
+		t.Error("swapping with an outdated value should fail")
+	}
+	if ok, err := store.CompareAndSwap("verdict/web/eu", []byte("down"), []byte("up")); !ok || err != nil {
+		t.Errorf("swapping with the current value should succeed (%v)", err)
+	}
+	if ok, _ := store.CompareAndSwap("leader", nil, []byte("a")); !ok {
+		t.Error("swapping a missing key should succeed")
+	}
+}
+
+func TestFileStore(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "cachet-monitor")
+	defer os.RemoveAll(dir)
+
+	testStore(t, &FileStore{Dir: dir})
+}
+
+func TestHTTPStore(t *testing.T) {
+	server := httptest.NewServer(NewKVServer("secret"))
+	defer server.Close()
+
+	testStore(t, NewHTTPStore(server.URL, "secret"))
+
+	if _, err := NewHTTPStore(server.URL, "wrong").Get("verdict/web/eu"); err == nil {
+		t.Error("invalid token should be rejected")
+	}
+}
+
+func TestLeaderElection(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "cachet-monitor")
+	defer os.RemoveAll(dir)
+
+	replicas := []*HAConfig{}
+	for _, id := range []string{"a", "b"} {
+		ha := &HAConfig{ID: id, Store: StoreConfig{Type: "file", Path: dir}}
+		if errs := ha.Validate("test"); len(errs) > 0 {
+			t.Fatalf("unexpected validation errors: %v", errs)
+		}
+		replicas = append(replicas, ha)
+	}
+
+	replicas[0].elect()
+	replicas[1].elect()
+	if leader, _ := replicas[0].IsLeader(); !leader {
+		t.Error("first replica should hold the lease")
+	}
+	if leader, _ := replicas[1].IsLeader(); leader {
+		t.Error("second replica should not be leader while the lease is held")
+	}
+
+	// a lease which was not renewed in time is not trusted
+	replicas[0].mu.Lock()
+	replicas[0].expires = time.Now().Add(time.Second)
+	replicas[0].mu.Unlock()
+	if leader, _ := replicas[0].IsLeader(); leader {
+		t.Error("first replica should not be leader once its lease is about to expire")
+	}
+	replicas[0].elect()
+	if leader, _ := replicas[0].IsLeader(); !leader {
+		t.Error("first replica should be leader again once its lease is renewed")
+	}
+
+	// releasing the lease hands it over on the next election
+	replicas[0].stopC = make(chan bool)
+	replicas[0].Stop()
+	replicas[1].elect()
+	if leader, term := replicas[1].IsLeader(); !leader || term != 1 {
+		t.Errorf("second replica should have taken over (leader: %t, term: %d)", leader, term)
+	}
+}
@@ -42,8 +42,12 @@ func (t *MessageTemplate) Exec(data interface{}) (string, string) {
 }
 
 func (t *MessageTemplate) exec(tpl *template.Template, data interface{}) string {
-	buf := new(bytes.Buffer)
+	if tpl == nil {
+		// no template for this monitor type
+		return ""
+	}
 
+	buf := new(bytes.Buffer)
 	tpl.Execute(buf, data)
 	return buf.String()
 }
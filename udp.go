@@ -0,0 +1,130 @@
+package cachet
+
+import (
+	"encoding/hex"
+	"errors"
+	"net"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+)
+
+// UDPMonitor sends a datagram to Target (host:port) and waits for the response
+type UDPMonitor struct {
+	AbstractMonitor `mapstructure:",squash"`
+
+	// Payload, as text or hex encoded (binary protocols)
+	Send    string
+	SendHex string `mapstructure:"send_hex"`
+	payload []byte
+
+	// Regexp the response has to match (any response otherwise)
+	ExpectedResponse string `mapstructure:"expected_response"`
+	responseRegexp   *regexp.Regexp
+
+	// For services which never answer (syslog...): the check passes unless the
+	// port is reported unreachable (ICMP) within Timeout
+	NoResponse bool `mapstructure:"no_response"`
+}
+
+func (monitor *UDPMonitor) test(l *logrus.Entry) bool {
+	response, err := monitor.exchange()
+	if err != nil {
+		monitor.lastFailReason = err.Error()
+		l.Infof("UDP check failed: %s", monitor.lastFailReason)
+		return false
+	}
+
+	if monitor.responseRegexp != nil && !monitor.responseRegexp.Match(response) {
+		monitor.lastFailReason = "Unexpected response: " + strconv.Quote(string(response)) + ".\nExpected to match: " + monitor.ExpectedResponse
+		l.Infof("UDP check failed: unexpected response")
+		return false
+	}
+
+	monitor.triggerShellHook(l, "on_success", monitor.ShellHookOnSuccess, string(response))
+
+	return true
+}
+
+// exchange sends the payload and returns the response
+func (monitor *UDPMonitor) exchange() ([]byte, error) {
+	deadline := time.Now().Add(monitor.Timeout * time.Second)
+
+	conn, err := net.DialTimeout("udp", monitor.Target, monitor.Timeout*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(deadline)
+
+	if _, err := conn.Write(monitor.payload); err != nil {
+		return nil, err
+	}
+
+	buf := make([]byte, 65535)
+	n, err := conn.Read(buf)
+	if err != nil {
+		if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+			if monitor.NoResponse {
+				return nil, nil
+			}
+			return nil, errors.New("No response within " + strconv.Itoa(int(monitor.Timeout)) + "s")
+		}
+		// ICMP port unreachable on the connected socket
+		return nil, err
+	}
+
+	return buf[:n], nil
+}
+
+func (mon *UDPMonitor) Validate() []string {
+	mon.Template.Investigating.SetDefault(defaultHTTPInvestigatingTpl)
+	mon.Template.Fixed.SetDefault(defaultHTTPFixedTpl)
+
+	errs := mon.AbstractMonitor.Validate()
+
+	if _, _, err := net.SplitHostPort(mon.Target); err != nil {
+		errs = append(errs, "'Target' has to be in host:port format")
+	}
+
+	if len(mon.Send) > 0 && len(mon.SendHex) > 0 {
+		errs = append(errs, "'send' and 'send_hex' are exclusive")
+	}
+	mon.payload = []byte(mon.Send)
+	if len(mon.SendHex) > 0 {
+		payload, err := hex.DecodeString(mon.SendHex)
+		if err != nil {
+			errs = append(errs, "Invalid 'send_hex': "+err.Error())
+		}
+		mon.payload = payload
+	}
+
+	mon.responseRegexp = nil
+	if len(mon.ExpectedResponse) > 0 {
+		if mon.NoResponse {
+			errs = append(errs, "'expected_response' and 'no_response' are exclusive")
+		}
+		exp, err := regexp.Compile(mon.ExpectedResponse)
+		if err != nil {
+			errs = append(errs, "Regexp compilation failure: "+err.Error())
+		}
+		mon.responseRegexp = exp
+	}
+
+	return errs
+}
+
+func (mon *UDPMonitor) Describe() []string {
+	features := mon.AbstractMonitor.Describe()
+	features = append(features, "Payload: "+strconv.Itoa(len(mon.payload))+" bytes")
+	if len(mon.ExpectedResponse) > 0 {
+		features = append(features, "Expected response: "+mon.ExpectedResponse)
+	}
+	if mon.NoResponse {
+		features = append(features, "No response expected")
+	}
+
+	return features
+}
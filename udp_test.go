@@ -0,0 +1,65 @@
+package cachet
+
+import (
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/Sirupsen/logrus"
+)
+
+func TestUDPMonitor(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	go func() {
+		buf := make([]byte, 1024)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			// silent on anything but ping
+			if string(buf[:n]) == "\xffping" {
+				conn.WriteTo([]byte("pong 42"), addr)
+			}
+		}
+	}()
+
+	l := logrus.WithFields(logrus.Fields{})
+	mon := &UDPMonitor{SendHex: "ff70696e67", ExpectedResponse: `^pong \d+$`}
+	mon.Name, mon.Target, mon.ComponentID, mon.Timeout = "udp", conn.LocalAddr().String(), 1, 1
+	if errs := mon.Validate(); len(errs) > 0 {
+		t.Fatalf("unexpected validation errors: %v", errs)
+	}
+	if !mon.test(l) {
+		t.Errorf("check should have passed: %s", mon.lastFailReason)
+	}
+
+	mon.ExpectedResponse = "^pong$"
+	mon.Validate()
+	if mon.test(l) || mon.lastFailReason != "Unexpected response: \"pong 42\".\nExpected to match: ^pong$" {
+		t.Errorf("unexpected fail reason: %s", mon.lastFailReason)
+	}
+
+	mon.SendHex, mon.Send, mon.ExpectedResponse = "", "hello", ""
+	mon.Validate()
+	if mon.test(l) || mon.lastFailReason != "No response within 1s" {
+		t.Errorf("unexpected fail reason: %s", mon.lastFailReason)
+	}
+
+	mon.NoResponse = true
+	if !mon.test(l) {
+		t.Errorf("check should have passed: %s", mon.lastFailReason)
+	}
+
+	// nothing listening: ICMP port unreachable
+	closed, _ := net.ListenPacket("udp", "127.0.0.1:0")
+	mon.Target = closed.LocalAddr().String()
+	closed.Close()
+	if mon.test(l) || !strings.Contains(mon.lastFailReason, "connection refused") {
+		t.Errorf("unexpected fail reason: %s", mon.lastFailReason)
+	}
+}
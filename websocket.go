@@ -0,0 +1,143 @@
+package cachet
+
+import (
+	"context"
+	"crypto/tls"
+	"net/http"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/gorilla/websocket"
+)
+
+// WebSocketMonitor performs the upgrade handshake and optionally exchanges a message
+type WebSocketMonitor struct {
+	AbstractMonitor `mapstructure:",squash"`
+
+	Headers map[string]string
+	// Text message sent once connected
+	Send string
+	// Regexp a received message has to match (within Timeout)
+	ExpectedMessage string `mapstructure:"expected_message"`
+	messageRegexp   *regexp.Regexp
+
+	Proxy *ProxyConfig
+}
+
+func (monitor *WebSocketMonitor) test(l *logrus.Entry) bool {
+	deadline := time.Now().Add(monitor.Timeout * time.Second)
+	ctx, cancel := context.WithDeadline(context.Background(), deadline)
+	defer cancel()
+
+	header := http.Header{}
+	for k, v := range monitor.Headers {
+		header.Add(k, v)
+	}
+	header.Set("User-Agent", "Cachet-Monitor")
+
+	dialer := websocket.Dialer{
+		Proxy:           monitor.Proxy.proxyFunc(),
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: !monitor.Strict},
+	}
+
+	conn, resp, err := dialer.DialContext(ctx, monitor.Target, header)
+	if err != nil {
+		monitor.lastFailReason = "WebSocket handshake failed: " + err.Error()
+		if resp != nil {
+			monitor.lastFailReason = "WebSocket handshake failed: HTTP response status " + strconv.Itoa(resp.StatusCode)
+		}
+		l.Infof("%s", monitor.lastFailReason)
+		return false
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(deadline)
+	conn.SetWriteDeadline(deadline)
+
+	if len(monitor.Send) > 0 {
+		if err := conn.WriteMessage(websocket.TextMessage, []byte(monitor.Send)); err != nil {
+			monitor.lastFailReason = "WebSocket write failed: " + err.Error()
+			l.Infof("%s", monitor.lastFailReason)
+			return false
+		}
+	}
+
+	received := ""
+	if monitor.messageRegexp != nil {
+		for {
+			_, message, err := conn.ReadMessage()
+			if err != nil {
+				monitor.lastFailReason = "No message matching " + monitor.ExpectedMessage + " received within " + strconv.Itoa(int(monitor.Timeout)) + "s: " + err.Error()
+				if len(received) > 0 {
+					monitor.lastFailReason += ".\nLast message: " + received
+				}
+				l.Infof("WebSocket error: no matching message")
+				return false
+			}
+
+			received = string(message)
+			if monitor.messageRegexp.Match(message) {
+				break
+			}
+			l.Debugf("Ignoring message: %s", received)
+		}
+	}
+
+	// close handshake: wait for the server to acknowledge
+	conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), deadline)
+	for {
+		if _, _, err := conn.NextReader(); err != nil {
+			if !websocket.IsCloseError(err, websocket.CloseNormalClosure) {
+				l.Debugf("WebSocket not closed cleanly: %v", err)
+			}
+			break
+		}
+	}
+
+	monitor.triggerShellHook(l, "on_success", monitor.ShellHookOnSuccess, received)
+
+	return true
+}
+
+func (mon *WebSocketMonitor) Validate() []string {
+	mon.Template.Investigating.SetDefault(defaultHTTPInvestigatingTpl)
+	mon.Template.Fixed.SetDefault(defaultHTTPFixedTpl)
+
+	errs := mon.AbstractMonitor.Validate()
+
+	if len(mon.Target) == 0 {
+		errs = append(errs, "'Target' has not been set")
+	}
+
+	mon.messageRegexp = nil
+	if len(mon.ExpectedMessage) > 0 {
+		exp, err := regexp.Compile(mon.ExpectedMessage)
+		if err != nil {
+			errs = append(errs, "Regexp compilation failure: "+err.Error())
+		}
+		mon.messageRegexp = exp
+	}
+
+	if mon.Proxy != nil {
+		errs = append(errs, mon.Proxy.Validate()...)
+	}
+
+	return errs
+}
+
+func (mon *WebSocketMonitor) Describe() []string {
+	features := mon.AbstractMonitor.Describe()
+	features = append(features, "Insecure: "+strconv.FormatBool(!mon.Strict))
+	if mon.Proxy != nil {
+		features = append(features, "Proxy: "+mon.Proxy.String())
+	}
+	if len(mon.Send) > 0 {
+		features = append(features, "Sends: "+mon.Send)
+	}
+	if len(mon.ExpectedMessage) > 0 {
+		features = append(features, "Expected message: "+mon.ExpectedMessage)
+	}
+
+	return features
+}
@@ -0,0 +1,60 @@
+package cachet
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/gorilla/websocket"
+)
+
+func TestWebSocketMonitor(t *testing.T) {
+	upgrader := websocket.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/broken" {
+			// what a proxy dropping the upgrade does
+			w.Write([]byte("OK"))
+			return
+		}
+
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		conn.WriteMessage(websocket.TextMessage, []byte(`{"type":"welcome"}`))
+		for {
+			kind, message, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			conn.WriteMessage(kind, []byte(`{"type":"pong","data":"`+string(message)+`"}`))
+		}
+	}))
+	defer server.Close()
+
+	l := logrus.WithFields(logrus.Fields{})
+	mon := &WebSocketMonitor{Send: "ping", ExpectedMessage: `"type":"pong"`}
+	mon.Name, mon.Target, mon.ComponentID, mon.Timeout = "ws", "ws"+strings.TrimPrefix(server.URL, "http")+"/", 1, 1
+	if errs := mon.Validate(); len(errs) > 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+
+	if !mon.test(l) {
+		t.Errorf("check should have passed: %s", mon.lastFailReason)
+	}
+
+	mon.ExpectedMessage = "never"
+	mon.Validate()
+	if mon.test(l) || !strings.Contains(mon.lastFailReason, `Last message: {"type":"pong","data":"ping"}`) {
+		t.Errorf("unexpected fail reason: %s", mon.lastFailReason)
+	}
+
+	mon.Target += "broken"
+	if mon.test(l) || mon.lastFailReason != "WebSocket handshake failed: HTTP response status 200" {
+		t.Errorf("unexpected fail reason: %s", mon.lastFailReason)
+	}
+}
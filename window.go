@@ -0,0 +1,89 @@
+package cachet
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ActiveWindow restricts the evaluation of a monitor to some days / hours
+type ActiveWindow struct {
+	// cron day-of-week syntax (mon-fri, sat,sun, 1-5, ...), every day when empty
+	Days string
+	// HH:MM, a 'to' before 'from' spans midnight
+	From string
+	To   string
+
+	days uint64
+	from int
+	to   int
+}
+
+func (w *ActiveWindow) Validate() []string {
+	errs := []string{}
+
+	if len(w.Days) == 0 {
+		w.Days = "*"
+	}
+
+	days, err := cronDow.parse(w.Days)
+	if err != nil {
+		errs = append(errs, "Active hours: invalid 'days': "+err.Error())
+	}
+	if days&(1<<7) > 0 {
+		days |= 1
+	}
+	w.days = days
+
+	if w.from, err = parseClock(w.From, 0); err != nil {
+		errs = append(errs, "Active hours: invalid 'from': "+err.Error())
+	}
+	if w.to, err = parseClock(w.To, 24*60); err != nil {
+		errs = append(errs, "Active hours: invalid 'to': "+err.Error())
+	}
+
+	return errs
+}
+
+// Active tells if now falls into the window
+func (w *ActiveWindow) Active(now time.Time) bool {
+	minute := now.Hour()*60 + now.Minute()
+	today := w.days&(1<<uint(now.Weekday())) > 0
+
+	if w.from < w.to {
+		return today && minute >= w.from && minute < w.to
+	}
+	if w.from == w.to {
+		return today
+	}
+
+	// spans midnight: the end of the window belongs to the previous day
+	yesterday := w.days&(1<<uint(now.AddDate(0, 0, -1).Weekday())) > 0
+
+	return (today && minute >= w.from) || (yesterday && minute < w.to)
+}
+
+func (w *ActiveWindow) describe() string {
+	return w.Days + " " + w.From + "-" + w.To
+}
+
+// parseClock converts HH:MM to minutes since midnight
+func parseClock(value string, def int) (int, error) {
+	if len(value) == 0 {
+		return def, nil
+	}
+
+	parts := strings.Split(value, ":")
+	if len(parts) != 2 {
+		return 0, errors.New("'" + value + "' is not in HH:MM format")
+	}
+
+	h, errH := strconv.Atoi(parts[0])
+	m, errM := strconv.Atoi(parts[1])
+	if errH != nil || errM != nil || h < 0 || m < 0 || m > 59 || h > 24 || (h == 24 && m > 0) {
+		return 0, errors.New("'" + value + "' is not a valid time of day")
+	}
+
+	return h*60 + m, nil
+}